@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"time"
+
 	"github.com/daemgo/gopkg/pkg/engine"
+	"github.com/daemgo/gopkg/pkg/log"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,21 +19,28 @@ var (
 
 func main() {
 
-	ginEngine := engine.New()
+	ginEngine := engine.Default()
 	group := ginEngine.Group("api/v1")
 
 	group.GET("/user", userResourceType, func(ctx *gin.Context) {
-		ctx.JSONP(200, "SUCCESS")
+		engine.OK(ctx, "SUCCESS")
 	})
 
 	group.PUT("/user/:user_id", userResourceType, func(ctx *gin.Context) {
 		userID := ctx.Param("user_id")
-		ctx.JSONP(200, fmt.Sprintf("%s + %s", "SUCCESS", userID))
+		engine.OK(ctx, fmt.Sprintf("%s + %s", "SUCCESS", userID))
+	})
+
+	ginEngine.OnStop(func(ctx context.Context) error {
+		return log.Sync()
 	})
 
-	err := ginEngine.Run(":3000")
+	err := ginEngine.Serve(context.Background(), engine.ServeOptions{
+		Addr:            ":3000",
+		ShutdownTimeout: 10 * time.Second,
+	})
 	if err != nil {
-		panic("Server start failed, please check code.....")
+		panic("Server stopped with error: " + err.Error())
 	}
 
 }
@@ -0,0 +1,314 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/log"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAuditBodySize = 4 << 10
+	defaultAuditTable    = "audit_logs"
+
+	redactedValue = "[REDACTED]"
+)
+
+var (
+	defaultRedactFields = []string{"password", "token", "secret", "authorization"}
+)
+
+// AuditEvent records who did what to which resource.
+type AuditEvent struct {
+	Time      time.Time         `json:"time"`
+	RequestID string            `json:"request_id"`
+	Actor     string            `json:"actor"`
+	Scope     ResourceScope     `json:"scope"`
+	Resource  string            `json:"resource"`
+	Action    string            `json:"action"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Route     string            `json:"route"`
+	Params    map[string]string `json:"params,omitempty"`
+	Status    int               `json:"status"`
+	Latency   time.Duration     `json:"latency"`
+	ClientIP  string            `json:"client_ip"`
+	Body      string            `json:"body,omitempty"`
+}
+
+// AuditSink receives the audit events.
+type AuditSink interface {
+	Write(ctx context.Context, event *AuditEvent) error
+}
+
+// LogAuditSink writes the audit events through a logger at the info level.
+type LogAuditSink struct {
+	logger *log.Logger
+}
+
+// NewLogAuditSink creates a LogAuditSink.
+func NewLogAuditSink(logger *log.Logger) *LogAuditSink {
+	return &LogAuditSink{logger: logger}
+}
+
+// Write implements AuditSink.
+func (s *LogAuditSink) Write(_ context.Context, event *AuditEvent) error {
+	s.logger.Infow("audit",
+		zap.Time("time", event.Time),
+		zap.String("request_id", event.RequestID),
+		zap.String("actor", event.Actor),
+		zap.String("scope", string(event.Scope)),
+		zap.String("resource", event.Resource),
+		zap.String("action", event.Action),
+		zap.String("method", event.Method),
+		zap.String("path", event.Path),
+		zap.String("route", event.Route),
+		zap.Any("params", event.Params),
+		zap.Int("status", event.Status),
+		zap.Duration("latency", event.Latency),
+		zap.String("client_ip", event.ClientIP),
+		zap.String("body", event.Body),
+	)
+	return nil
+}
+
+// AuditRecord is the table row written by GormAuditSink.
+type AuditRecord struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement"`
+	Time      time.Time `gorm:"index"`
+	RequestID string    `gorm:"size:64"`
+	Actor     string    `gorm:"size:128;index"`
+	Scope     string    `gorm:"size:64"`
+	Resource  string    `gorm:"size:64;index"`
+	Action    string    `gorm:"size:16"`
+	Method    string    `gorm:"size:16"`
+	Path      string    `gorm:"size:1024"`
+	Route     string    `gorm:"size:255"`
+	Params    string    `gorm:"type:text"`
+	Status    int
+	LatencyMs int64
+	ClientIP  string `gorm:"size:64"`
+	Body      string `gorm:"type:text"`
+}
+
+// GormAuditSink writes the audit events into a table.
+type GormAuditSink struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewGormAuditSink creates a GormAuditSink writing into table,
+// which is "audit_logs" if it's empty.
+func NewGormAuditSink(db *gorm.DB, table string) *GormAuditSink {
+	if table == "" {
+		table = defaultAuditTable
+	}
+	return &GormAuditSink{db: db, table: table}
+}
+
+// AutoMigrate creates or updates the audit table.
+func (s *GormAuditSink) AutoMigrate() error {
+	return s.db.Table(s.table).AutoMigrate(&AuditRecord{})
+}
+
+// Write implements AuditSink.
+func (s *GormAuditSink) Write(ctx context.Context, event *AuditEvent) error {
+	params, err := json.Marshal(event.Params)
+	if err != nil {
+		return err
+	}
+	record := &AuditRecord{
+		Time:      event.Time,
+		RequestID: event.RequestID,
+		Actor:     event.Actor,
+		Scope:     string(event.Scope),
+		Resource:  event.Resource,
+		Action:    event.Action,
+		Method:    event.Method,
+		Path:      event.Path,
+		Route:     event.Route,
+		Params:    string(params),
+		Status:    event.Status,
+		LatencyMs: event.Latency.Milliseconds(),
+		ClientIP:  event.ClientIP,
+		Body:      event.Body,
+	}
+	return s.db.WithContext(ctx).Table(s.table).Create(record).Error
+}
+
+// AuditOptions configures the Audit middleware.
+type AuditOptions struct {
+	// Sink receives the events, a LogAuditSink writing through the logger
+	// of the engine by default.
+	Sink AuditSink
+	// Methods are the audited methods, every method by default.
+	Methods []string
+	// ActorFunc extracts who made the request, ActorFromPrincipal by default.
+	ActorFunc func(ctx *gin.Context) string
+	// CaptureBody captures the request body into the event.
+	CaptureBody bool
+	// MaxBodySize is the maximum number of captured bytes, 4KiB by default.
+	MaxBodySize int
+	// RedactFields are the JSON keys whose values are redacted from the
+	// captured body, case insensitive. Defaults to password, token,
+	// secret and authorization.
+	RedactFields []string
+}
+
+// AuditAction maps the HTTP method to the action done on the resource.
+func AuditAction(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "read"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut, http.MethodPatch:
+		return "update"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return strings.ToLower(method)
+	}
+}
+
+// Audit returns a middleware which sends an AuditEvent to the sink for
+// every audited request.
+func (e *Engine) Audit(opts AuditOptions) gin.HandlerFunc {
+	if opts.Sink == nil {
+		opts.Sink = NewLogAuditSink(e.logger)
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultAuditBodySize
+	}
+	if opts.RedactFields == nil {
+		opts.RedactFields = defaultRedactFields
+	}
+	if opts.ActorFunc == nil {
+		opts.ActorFunc = ActorFromPrincipal
+	}
+	methods := make(map[string]bool, len(opts.Methods))
+	for _, m := range opts.Methods {
+		methods[strings.ToUpper(m)] = true
+	}
+
+	return func(ctx *gin.Context) {
+		if len(methods) > 0 && !methods[ctx.Request.Method] {
+			ctx.Next()
+			return
+		}
+
+		var body string
+		if opts.CaptureBody && ctx.Request.Body != nil {
+			body = redactBody(captureBody(ctx.Request, opts.MaxBodySize), opts.RedactFields)
+		}
+
+		start := time.Now()
+		ctx.Next()
+
+		typ, _ := e.ResourceTypeOf(ctx)
+		event := &AuditEvent{
+			Time:      start,
+			RequestID: RequestIDFrom(ctx),
+			Actor:     opts.ActorFunc(ctx),
+			Scope:     typ.Scope,
+			Resource:  typ.Resource,
+			Action:    AuditAction(ctx.Request.Method),
+			Method:    ctx.Request.Method,
+			Path:      ctx.Request.URL.Path,
+			Route:     ctx.FullPath(),
+			Status:    ctx.Writer.Status(),
+			Latency:   time.Since(start),
+			ClientIP:  ctx.ClientIP(),
+			Body:      body,
+		}
+		if len(ctx.Params) > 0 {
+			event.Params = make(map[string]string, len(ctx.Params))
+			for _, p := range ctx.Params {
+				event.Params[p.Key] = p.Value
+			}
+		}
+
+		if err := opts.Sink.Write(ctx.Request.Context(), event); err != nil {
+			e.logger.Errorw("failed to write audit event",
+				zap.String("request_id", event.RequestID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// captureBody reads up to max bytes of the body and puts them back,
+// so the handlers still see the whole body.
+func captureBody(req *http.Request, max int) []byte {
+	buf := make([]byte, max)
+	n, err := io.ReadFull(req.Body, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil
+	}
+	buf = buf[:n]
+	req.Body = readCloser{
+		Reader: io.MultiReader(bytes.NewReader(buf), req.Body),
+		Closer: req.Body,
+	}
+	return buf
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// redactBody replaces the values of the fields in a JSON body, bodies
+// which are not valid JSON, e.g. the truncated ones, are redacted whole.
+func redactBody(body []byte, fields []string) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return redactedValue
+	}
+
+	p, err := json.Marshal(redactValue(v, fields))
+	if err != nil {
+		return redactedValue
+	}
+	return string(p)
+}
+
+func redactValue(v interface{}, fields []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if containsFold(fields, k) {
+				t[k] = redactedValue
+			} else {
+				t[k] = redactValue(val, fields)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redactValue(t[i], fields)
+		}
+	}
+	return v
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/mock"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryAuditSink struct {
+	events []*AuditEvent
+}
+
+func (s *memoryAuditSink) Write(_ context.Context, event *AuditEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	sink := &memoryAuditSink{}
+	e := New()
+	e.Use(e.Audit(AuditOptions{
+		Sink:        sink,
+		Methods:     []string{http.MethodPut, http.MethodDelete},
+		CaptureBody: true,
+		ActorFunc: func(c *gin.Context) string {
+			return c.GetHeader("X-User")
+		},
+	}))
+
+	var handlerBody map[string]interface{}
+	group := e.Group("/api/v1")
+	group.PUT("/users/:user_id", userResourceType, func(c *gin.Context) {
+		assert.Nil(t, c.ShouldBindJSON(&handlerBody))
+		c.Status(http.StatusNoContent)
+	})
+	group.GET("/users/:user_id", userResourceType, func(c *gin.Context) {})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/users/42",
+		strings.NewReader(`{"name":"alex","password":"p","nested":[{"Token":"t"}]}`))
+	req.Header.Set("X-User", "admin")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/users/42", nil))
+
+	assert.Equal(t, "p", handlerBody["password"], "handler should see the original body")
+	assert.Len(t, sink.events, 1)
+
+	event := sink.events[0]
+	assert.Equal(t, "admin", event.Actor)
+	assert.Equal(t, userResourceType.Scope, event.Scope)
+	assert.Equal(t, "user", event.Resource)
+	assert.Equal(t, "update", event.Action)
+	assert.Equal(t, "/api/v1/users/:user_id", event.Route)
+	assert.Equal(t, map[string]string{"user_id": "42"}, event.Params)
+	assert.Equal(t, http.StatusNoContent, event.Status)
+	assert.JSONEq(t, `{"name":"alex","password":"[REDACTED]","nested":[{"Token":"[REDACTED]"}]}`, event.Body)
+}
+
+func TestRedactTruncatedBody(t *testing.T) {
+	assert.Equal(t, redactedValue, redactBody([]byte(`{"password":"p`), defaultRedactFields))
+	assert.Equal(t, redactedValue, redactBody([]byte(`{"name":"al`), defaultRedactFields))
+	assert.Equal(t, redactedValue, redactBody([]byte(`name=alex`), defaultRedactFields))
+}
+
+func TestGormAuditSink(t *testing.T) {
+	db, m, err := mock.GetNewMySqlMock()
+	assert.Nil(t, err)
+
+	m.ExpectBegin()
+	m.ExpectExec("INSERT INTO `audit_events`").
+		WithArgs(sqlmock.AnyArg(), "1", "admin", "management", "user", "delete", http.MethodDelete,
+			"/api/v1/users/42", "/api/v1/users/:user_id", `{"user_id":"42"}`, http.StatusOK, int64(3), "127.0.0.1", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	m.ExpectCommit()
+
+	sink := NewGormAuditSink(db, "audit_events")
+	err = sink.Write(context.Background(), &AuditEvent{
+		Time:      time.Now(),
+		RequestID: "1",
+		Actor:     "admin",
+		Scope:     "management",
+		Resource:  "user",
+		Action:    "delete",
+		Method:    http.MethodDelete,
+		Path:      "/api/v1/users/42",
+		Route:     "/api/v1/users/:user_id",
+		Params:    map[string]string{"user_id": "42"},
+		Status:    http.StatusOK,
+		Latency:   3 * time.Millisecond,
+		ClientIP:  "127.0.0.1",
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, m.ExpectationsWereMet())
+}
+
+func TestLogAuditSink(t *testing.T) {
+	logger, fws := newTestLogger(t)
+	sink := NewLogAuditSink(logger)
+	assert.Nil(t, sink.Write(context.Background(), &AuditEvent{Actor: "admin", Resource: "user"}))
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(fws.buf.Bytes(), &entry))
+	assert.Equal(t, "audit", entry["message"])
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "admin", entry["actor"])
+}
+
+func TestAuditDefaultSink(t *testing.T) {
+	logger, fws := newTestLogger(t)
+	e := New(WithLogger(logger))
+	e.Use(e.Audit(AuditOptions{}))
+	e.Group("/api/v1").DELETE("/users/:user_id", userResourceType, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/users/1", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(fws.buf.Bytes(), &entry))
+	assert.Equal(t, "audit", entry["message"])
+	assert.Equal(t, "delete", entry["action"])
+}
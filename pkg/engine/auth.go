@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+
+	// HeaderAPIKey is the default header carrying the API key.
+	HeaderAPIKey = "X-API-Key"
+
+	principalContextKey = "engine/principal"
+)
+
+type principalKey struct{}
+
+// Principal is the identity which made the request.
+type Principal struct {
+	// Subject identifies the user or the service.
+	Subject string `json:"subject"`
+	// Roles are the roles granted to the subject.
+	Roles []string `json:"roles,omitempty"`
+	// Tenant is the tenant the subject belongs to.
+	Tenant string `json:"tenant,omitempty"`
+	// Method is how the principal was authenticated.
+	Method string `json:"method"`
+	// Claims are the raw claims of a JWT.
+	Claims map[string]interface{} `json:"-"`
+}
+
+// HasRole reports whether the principal was granted role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPrincipal stores p in both the gin context and the request context.
+func SetPrincipal(ctx *gin.Context, p *Principal) {
+	ctx.Set(principalContextKey, p)
+	ctx.Request = ctx.Request.WithContext(WithPrincipal(ctx.Request.Context(), p))
+}
+
+// PrincipalFrom returns the principal stored in the gin context.
+func PrincipalFrom(ctx *gin.Context) (*Principal, bool) {
+	v, ok := ctx.Get(principalContextKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok
+}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal carried by ctx, it's useful
+// in the layers which only see the request context.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// ActorFromPrincipal returns the subject of the principal, it's the
+// default actor of the audit events.
+func ActorFromPrincipal(ctx *gin.Context) string {
+	if p, ok := PrincipalFrom(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// KeyByPrincipal limits by the authenticated subject and falls back to
+// the client IP for anonymous requests.
+func KeyByPrincipal(ctx *gin.Context) string {
+	if p, ok := PrincipalFrom(ctx); ok && p.Subject != "" {
+		return "principal:" + p.Subject
+	}
+	return KeyByIP(ctx)
+}
+
+// AuthOptions configures the Authenticate middleware.
+type AuthOptions struct {
+	// JWT verifies the bearer tokens, bearer tokens are rejected if it's nil.
+	JWT *JWTVerifier
+	// APIKeys maps the static API keys to their principals.
+	APIKeys map[string]Principal
+	// APIKeyHeader is the header carrying the API key, "X-API-Key" by default.
+	APIKeyHeader string
+	// Optional lets the requests without credentials pass anonymously,
+	// invalid credentials are still rejected.
+	Optional bool
+}
+
+// Authenticate returns a middleware which authenticates the request by a
+// bearer JWT or an API key and stores the Principal in the context.
+func Authenticate(opts AuthOptions) gin.HandlerFunc {
+	if opts.APIKeyHeader == "" {
+		opts.APIKeyHeader = HeaderAPIKey
+	}
+
+	return func(ctx *gin.Context) {
+		if token, ok := bearerToken(ctx); ok {
+			if opts.JWT == nil {
+				unauthorized(ctx, "bearer tokens are not accepted")
+				return
+			}
+			p, err := opts.JWT.Verify(token)
+			if err != nil {
+				unauthorized(ctx, err.Error())
+				return
+			}
+			SetPrincipal(ctx, p)
+			ctx.Next()
+			return
+		}
+
+		if key := ctx.GetHeader(opts.APIKeyHeader); key != "" {
+			p, ok := matchAPIKey(opts.APIKeys, key)
+			if !ok {
+				unauthorized(ctx, "api key is invalid")
+				return
+			}
+			SetPrincipal(ctx, p)
+			ctx.Next()
+			return
+		}
+
+		if !opts.Optional {
+			unauthorized(ctx, "credentials are missing")
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func bearerToken(ctx *gin.Context) (string, bool) {
+	auth := ctx.GetHeader("Authorization")
+	scheme, token, ok := strings.Cut(auth, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// matchAPIKey compares key with every API key in constant time.
+func matchAPIKey(keys map[string]Principal, key string) (*Principal, bool) {
+	var found *Principal
+	for k, p := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			p := p
+			p.Method = AuthMethodAPIKey
+			found = &p
+		}
+	}
+	return found, found != nil
+}
+
+func unauthorized(ctx *gin.Context, message string) {
+	ctx.Header("WWW-Authenticate", `Bearer realm="api"`)
+	Fail(ctx, response.ErrUnauthorized.WithMessage(message))
+}
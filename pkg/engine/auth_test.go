@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keys := NewKeySet()
+	keys.AddHMAC("k1", testHMACSecret)
+
+	e := New()
+	e.Use(Authenticate(AuthOptions{
+		JWT: NewJWTVerifier(JWTOptions{Keys: keys}),
+		APIKeys: map[string]Principal{
+			"key-1": {Subject: "billing-service", Roles: []string{"service"}},
+		},
+	}))
+
+	var got *Principal
+	e.Group("/api/v1").GET("/users", userResourceType, func(c *gin.Context) {
+		got, _ = PrincipalFrom(c)
+		fromCtx, ok := PrincipalFromContext(c.Request.Context())
+		assert.True(t, ok)
+		assert.Same(t, got, fromCtx)
+		c.Status(http.StatusOK)
+	})
+
+	do := func(header, value string) *httptest.ResponseRecorder {
+		got = nil
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	token := signTestJWT(t, AlgHS256, "k1", testHMACSecret, map[string]interface{}{
+		"sub":   "alex",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"roles": "admin auditor",
+	})
+	w := do("Authorization", "Bearer "+token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alex", got.Subject)
+	assert.True(t, got.HasRole("auditor"))
+
+	w = do(HeaderAPIKey, "key-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "billing-service", got.Subject)
+	assert.Equal(t, AuthMethodAPIKey, got.Method)
+
+	w = do(HeaderAPIKey, "key-2")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "api key is invalid", decodeResponse(t, w).Error.Message)
+
+	w = do("Authorization", "Bearer "+token+"x")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+	w = do("", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Nil(t, got)
+}
+
+func TestAuthenticateOptional(t *testing.T) {
+	e := New()
+	e.Use(Authenticate(AuthOptions{Optional: true}))
+	e.Group("/").GET("/", userResourceType, func(c *gin.Context) {
+		_, ok := PrincipalFrom(c)
+		assert.False(t, ok)
+		assert.Empty(t, ActorFromPrincipal(c))
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a principal carried by the request context is not a credential
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(WithPrincipal(req.Context(), &Principal{Subject: "alex"}))
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// injectPrincipal authenticates the test requests as the principal carried
+// by their context.
+func injectPrincipal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p, ok := PrincipalFromContext(c.Request.Context()); ok {
+			SetPrincipal(c, p)
+		}
+	}
+}
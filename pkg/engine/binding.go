@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+	"github.com/daemgo/gopkg/pkg/is"
+	"github.com/daemgo/gopkg/pkg/regex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	// fieldNameTags are the struct tags used to name a field in the
+	// validation errors, the first non-empty one wins.
+	fieldNameTags = []string{"json", "form", "uri", "header"}
+
+	stringValidators = map[string]func(string) bool{
+		"is_email":            is.IsEmail,
+		"is_number":           is.IsNumber,
+		"is_ascii_letter":     is.IsASCIILetter,
+		"regex_letter":        regexValidator(regex.RegexLetter),
+		"regex_letter_number": regexValidator(regex.RegexLetterNumber),
+		"regex_number":        regexValidator(regex.RegexNumber),
+		"regex_email":         regex.RegexEmailPattern.MatchString,
+		"regex_datetime":      regex.RegexDateTimePattern.MatchString,
+	}
+)
+
+var registerValidatorsOnce sync.Once
+
+// RegisterValidators configures gin's global binding.Validator with the
+// field naming and the string validations used by Bind. New calls it, it's
+// only needed to Bind without an Engine. It's safe to call it repeatedly.
+func RegisterValidators() {
+	registerValidatorsOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+
+		v.RegisterTagNameFunc(fieldName)
+		for tag, fn := range stringValidators {
+			_ = RegisterStringValidation(tag, fn)
+		}
+	})
+}
+
+// regexValidator compiles pattern once, it panics if it's invalid.
+func regexValidator(pattern string) func(string) bool {
+	return regexp.MustCompile(pattern).MatchString
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, tag := range fieldNameTags {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return ""
+}
+
+// RegisterStringValidation registers fn as the struct tag validation
+// named tag, which only applies to string fields.
+func RegisterStringValidation(tag string, fn func(string) bool) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return nil
+	}
+	return v.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+		field := fl.Field()
+		if field.Kind() != reflect.String {
+			return false
+		}
+		return fn(field.String())
+	})
+}
+
+// Bind binds the URI params, headers, query and body of the request to a T,
+// then validates it. The error is an APIError with the invalid fields named
+// after their json, form, uri or header tags.
+func Bind[T any](ctx *gin.Context) (T, error) {
+	var obj T
+	if err := bindRequest(ctx, &obj); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return obj, response.ErrPayloadTooLarge
+		}
+		return obj, response.ErrBadRequest.WithMessage(err.Error())
+	}
+	if err := binding.Validator.ValidateStruct(&obj); err != nil {
+		return obj, validationError(err)
+	}
+	return obj, nil
+}
+
+// MustBind works like Bind but fails the request with the error,
+// the second return value reports whether it succeeded.
+func MustBind[T any](ctx *gin.Context) (T, bool) {
+	obj, err := Bind[T](ctx)
+	if err != nil {
+		Fail(ctx, err)
+		return obj, false
+	}
+	return obj, true
+}
+
+// headerForm keys the header values by the header tags of obj, since the
+// tags are not required to be in the canonical form.
+func headerForm(header http.Header, obj interface{}) map[string][]string {
+	form := make(map[string][]string)
+	typ := reflect.TypeOf(obj).Elem()
+	if typ.Kind() != reflect.Struct {
+		return form
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("header"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if values := header.Values(name); len(values) > 0 {
+			form[name] = values
+		}
+	}
+	return form
+}
+
+func bindRequest(ctx *gin.Context, obj interface{}) error {
+	params := make(map[string][]string, len(ctx.Params))
+	for _, p := range ctx.Params {
+		params[p.Key] = []string{p.Value}
+	}
+	if err := binding.MapFormWithTag(obj, params, "uri"); err != nil {
+		return err
+	}
+
+	if err := binding.MapFormWithTag(obj, headerForm(ctx.Request.Header, obj), "header"); err != nil {
+		return err
+	}
+
+	if err := binding.MapFormWithTag(obj, ctx.Request.URL.Query(), "form"); err != nil {
+		return err
+	}
+
+	if ctx.Request.Body == nil || ctx.Request.Method == http.MethodGet {
+		return nil
+	}
+	switch ctx.ContentType() {
+	case binding.MIMEJSON:
+		err := json.NewDecoder(ctx.Request.Body).Decode(obj)
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	case binding.MIMEPOSTForm, binding.MIMEMultipartPOSTForm:
+		if err := ctx.Request.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+			return err
+		}
+		return binding.MapFormWithTag(obj, ctx.Request.PostForm, "form")
+	}
+	return nil
+}
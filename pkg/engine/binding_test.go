@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type updateUserRequest struct {
+	UserID   string `uri:"user_id" binding:"required,is_number"`
+	TenantID string `header:"X-Tenant-ID" json:"-" binding:"required"`
+	DryRun   bool   `form:"dry_run"`
+	Name     string `json:"name" binding:"required,is_ascii_letter"`
+	Email    string `json:"email" binding:"omitempty,is_email"`
+	Code     string `json:"code" binding:"omitempty,regex_letter_number"`
+}
+
+func TestBind(t *testing.T) {
+	e := New()
+	var got updateUserRequest
+	e.Group("/api/v1").PUT("/users/:user_id", userResourceType, func(c *gin.Context) {
+		req, ok := MustBind[updateUserRequest](c)
+		if !ok {
+			return
+		}
+		got = req
+		OK(c, nil)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/users/42?dry_run=true",
+		strings.NewReader(`{"name":"alex","email":"alex@example.com","code":"a1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-ID", "acme")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, updateUserRequest{
+		UserID:   "42",
+		TenantID: "acme",
+		DryRun:   true,
+		Name:     "alex",
+		Email:    "alex@example.com",
+		Code:     "a1",
+	}, got)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/users/abc",
+		strings.NewReader(`{"name":"alex1","email":"bad","code":"a-1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	resp := decodeResponse(t, w)
+	assert.Equal(t, "VALIDATION_FAILED", resp.Error.Code)
+	var fields []string
+	for _, d := range resp.Error.Details.([]interface{}) {
+		fe := d.(map[string]interface{})
+		fields = append(fields, fe["field"].(string)+":"+fe["rule"].(string))
+	}
+	assert.Equal(t, []string{
+		"user_id:is_number",
+		"X-Tenant-ID:required",
+		"name:is_ascii_letter",
+		"email:is_email",
+		"code:regex_letter_number",
+	}, fields)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/users/1", strings.NewReader(`{`))
+	req.Header.Set("Content-Type", "application/json")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, response.ErrBadRequest.Code, decodeResponse(t, w).Error.Code)
+}
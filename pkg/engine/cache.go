@@ -0,0 +1,337 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HeaderETag        = "ETag"
+	HeaderIfNoneMatch = "If-None-Match"
+	HeaderXCache      = "X-Cache"
+
+	defaultCacheMaxEntries = 1024
+	defaultCacheBodySize   = 1 << 20
+)
+
+// bufferedWriter holds back the whole response, so that it can be
+// replaced by a 304 once the ETag is known.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	w.WriteHeaderNow()
+	return w.body.Write(p)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if w.status == 0 {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.status != 0
+}
+
+// Flush is a no-op, the response is written once the handlers return.
+func (w *bufferedWriter) Flush() {}
+
+// computeETag returns a strong ETag of body.
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatch reports whether the If-None-Match header matches etag, using
+// the weak comparison.
+func etagMatch(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConditional writes the response, or a 304 if the client already
+// has it.
+func writeConditional(ctx *gin.Context, w gin.ResponseWriter, status int, body []byte) {
+	if status == http.StatusOK && etagMatch(ctx.GetHeader(HeaderIfNoneMatch), w.Header().Get(HeaderETag)) {
+		h := w.Header()
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		w.WriteHeaderNow()
+		return
+	}
+	w.WriteHeader(status)
+	w.WriteHeaderNow()
+	_, _ = w.Write(body)
+}
+
+// ETag returns a middleware which sets an ETag computed from the body of
+// the successful GET responses and answers If-None-Match with 304. The
+// responses are buffered, so it should not be used with streaming routes.
+func ETag() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet {
+			ctx.Next()
+			return
+		}
+
+		w := &bufferedWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = w
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+
+		body := w.body.Bytes()
+		if w.Status() == http.StatusOK && w.Header().Get(HeaderETag) == "" {
+			w.Header().Set(HeaderETag, computeETag(body))
+		}
+		writeConditional(ctx, ctx.Writer, w.Status(), body)
+	}
+}
+
+type cacheEntry struct {
+	typ      ResourceType
+	header   http.Header
+	body     []byte
+	expireAt time.Time
+}
+
+// CacheOptions configures a ResponseCache.
+type CacheOptions struct {
+	// TTL is how long the responses are cached.
+	TTL time.Duration
+	// VaryHeaders are the request headers which are part of the cache key.
+	VaryHeaders []string
+	// Shared caches the responses across the principals of a tenant, by
+	// default every principal has its own entries.
+	Shared bool
+	// MaxEntries is the maximum number of entries, 1024 by default.
+	MaxEntries int
+	// MaxBodySize is the maximum size of a cached body, 1MiB by default.
+	MaxBodySize int
+}
+
+// ResponseCache caches the successful GET responses in memory and purges
+// them when a resource of the same ResourceType is modified. Only the
+// headers set by the handlers are cached, without Set-Cookie, and the
+// responses which Vary on headers missing from VaryHeaders are not cached.
+type ResponseCache struct {
+	engine *Engine
+	opts   CacheOptions
+
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+	now     func() time.Time
+}
+
+// NewResponseCache creates a ResponseCache for the routes of e.
+func (e *Engine) NewResponseCache(opts CacheOptions) *ResponseCache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultCacheMaxEntries
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultCacheBodySize
+	}
+	return &ResponseCache{
+		engine:  e,
+		opts:    opts,
+		entries: make(map[string]*cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Invalidate purges the cached responses of typ, an empty Resource purges
+// the whole Scope.
+func (c *ResponseCache) Invalidate(typ ResourceType) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, entry := range c.entries {
+		if entry.typ.Scope == typ.Scope && (typ.Resource == "" || entry.typ.Resource == typ.Resource) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// key identifies the response of the request, the host and the tenant are
+// part of it since the same path may be served for several tenants.
+func (c *ResponseCache) key(ctx *gin.Context) string {
+	tenant, _ := TenantFrom(ctx)
+	var b strings.Builder
+	b.WriteString(ctx.Request.Host + ctx.Request.URL.RequestURI())
+	b.WriteString("\ntenant:" + tenant)
+	for _, h := range c.opts.VaryHeaders {
+		b.WriteString("\n" + h + ":" + ctx.GetHeader(h))
+	}
+	if !c.opts.Shared {
+		b.WriteString("\nprincipal:" + ActorFromPrincipal(ctx))
+	}
+	return b.String()
+}
+
+func (c *ResponseCache) get(key string) (*cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	if ok && c.now().After(entry.expireAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry, ok
+}
+
+func (c *ResponseCache) set(key string, entry *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.opts.MaxEntries {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.expireAt.Before(c.entries[oldest].expireAt) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = entry
+}
+
+// varies reports whether the cache key covers the request headers the
+// response varies on, the responses varying on others are not cached.
+func (c *ResponseCache) varies(vary []string) bool {
+	for _, v := range vary {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" || (name != "" && !containsFold(c.opts.VaryHeaders, name)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// headerSetSince returns the headers of after which are not in before or
+// have other values, i.e. the ones set by the handlers and not by the
+// outer middlewares.
+func headerSetSince(before, after http.Header) http.Header {
+	header := http.Header{}
+	for k, v := range after {
+		if !equalValues(before[k], v) {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	return header
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware returns a middleware which serves the GET requests from the
+// cache, with ETags and 304 answers, and purges the cached responses of a
+// ResourceType once a POST, PUT, PATCH or DELETE on it succeeds.
+func (c *ResponseCache) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		typ, _ := c.engine.ResourceTypeOf(ctx)
+		if ctx.Request.Method != http.MethodGet {
+			ctx.Next()
+			if ctx.Request.Method != http.MethodHead && ctx.Request.Method != http.MethodOptions &&
+				ctx.Writer.Status() < http.StatusBadRequest {
+				c.Invalidate(typ)
+			}
+			return
+		}
+
+		key := c.key(ctx)
+		if entry, ok := c.get(key); ok {
+			h := ctx.Writer.Header()
+			for k, v := range entry.header {
+				h[k] = v
+			}
+			h.Set(HeaderXCache, "HIT")
+			writeConditional(ctx, ctx.Writer, http.StatusOK, entry.body)
+			ctx.Abort()
+			return
+		}
+
+		before := ctx.Writer.Header().Clone()
+		w := &bufferedWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = w
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+
+		body := w.body.Bytes()
+		if w.Status() == http.StatusOK {
+			if w.Header().Get(HeaderETag) == "" {
+				w.Header().Set(HeaderETag, computeETag(body))
+			}
+			header := headerSetSince(before, w.Header())
+			header.Del(HeaderRequestID)
+			header.Del("Set-Cookie")
+			cacheable := c.opts.TTL > 0 && len(body) <= c.opts.MaxBodySize &&
+				!strings.Contains(w.Header().Get("Cache-Control"), "no-store") &&
+				c.varies(header.Values("Vary"))
+			if cacheable {
+				c.set(key, &cacheEntry{
+					typ:      typ,
+					header:   header,
+					body:     append([]byte(nil), body...),
+					expireAt: c.now().Add(c.opts.TTL),
+				})
+			}
+			w.Header().Set(HeaderXCache, "MISS")
+		}
+		writeConditional(ctx, ctx.Writer, w.Status(), body)
+	}
+}
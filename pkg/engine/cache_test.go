@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	e := New()
+	e.Use(ETag())
+
+	group := e.Group("/api/v1")
+	group.GET("/books/:book_id", bookResourceType, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("book_id")})
+	})
+	group.GET("/missing", bookResourceType, func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{})
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/books/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"1"}`, w.Body.String())
+	etag := w.Header().Get(HeaderETag)
+	assert.NotEmpty(t, etag)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/books/1", nil)
+	req.Header.Set(HeaderIfNoneMatch, `"other", W/`+etag)
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/books/2", nil)
+	req.Header.Set(HeaderIfNoneMatch, etag)
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get(HeaderETag))
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get(HeaderETag))
+}
+
+func TestResponseCache(t *testing.T) {
+	e := New()
+	cache := e.NewResponseCache(CacheOptions{TTL: time.Minute, VaryHeaders: []string{"Accept-Language"}})
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	cache.now = clock.Now
+	var outer int
+	e.Use(func(c *gin.Context) {
+		outer++
+		c.Header("X-Outer", strconv.Itoa(outer))
+	}, cache.Middleware())
+
+	calls := map[string]int{}
+	group := e.Group("/api/v1")
+	group.GET("/users/:user_id", userResourceType, func(c *gin.Context) {
+		calls["user"]++
+		c.Header("Vary", "Accept-Language")
+		c.SetCookie("session", "s1", 0, "/", "", false, true)
+		c.JSON(http.StatusOK, gin.H{"n": calls["user"], "lang": c.GetHeader("Accept-Language")})
+	})
+	group.GET("/books", bookResourceType, func(c *gin.Context) {
+		calls["books"]++
+		c.Header("Vary", "Authorization")
+		c.JSON(http.StatusOK, gin.H{"n": calls["books"]})
+	})
+	group.PUT("/users/:user_id", userResourceType, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	group.GET("/books/:book_id", bookResourceType, func(c *gin.Context) {
+		calls["book"]++
+		c.JSON(http.StatusOK, gin.H{"n": calls["book"]})
+	})
+
+	do := func(method, path, lang string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if lang != "" {
+			req.Header.Set("Accept-Language", lang)
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/api/v1/users/1", "en")
+	assert.Equal(t, "MISS", w.Header().Get(HeaderXCache))
+	etag := w.Header().Get(HeaderETag)
+
+	w = do(http.MethodGet, "/api/v1/users/1", "en")
+	assert.Equal(t, "HIT", w.Header().Get(HeaderXCache))
+	assert.Equal(t, etag, w.Header().Get(HeaderETag))
+	assert.JSONEq(t, `{"n":1,"lang":"en"}`, w.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "2", w.Header().Get("X-Outer"), "outer headers are not replayed")
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+	assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+
+	do(http.MethodGet, "/api/v1/books", "")
+	w = do(http.MethodGet, "/api/v1/books", "")
+	assert.Equal(t, "MISS", w.Header().Get(HeaderXCache))
+	assert.Equal(t, 2, calls["books"])
+
+	w = do(http.MethodGet, "/api/v1/users/1", "fr")
+	assert.Equal(t, "MISS", w.Header().Get(HeaderXCache))
+	assert.Equal(t, 2, calls["user"])
+
+	do(http.MethodGet, "/api/v1/books/1", "")
+	do(http.MethodPut, "/api/v1/users/1", "")
+
+	w = do(http.MethodGet, "/api/v1/users/1", "en")
+	assert.Equal(t, "MISS", w.Header().Get(HeaderXCache))
+	assert.Equal(t, 3, calls["user"])
+	w = do(http.MethodGet, "/api/v1/books/1", "")
+	assert.Equal(t, "HIT", w.Header().Get(HeaderXCache))
+	assert.Equal(t, 1, calls["book"])
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	w = do(http.MethodGet, "/api/v1/books/1", "")
+	assert.Equal(t, "MISS", w.Header().Get(HeaderXCache))
+	assert.Equal(t, 2, calls["book"])
+}
+
+func TestResponseCacheTenants(t *testing.T) {
+	e := New()
+	cache := e.NewResponseCache(CacheOptions{TTL: time.Minute, Shared: true})
+	e.Use(e.Tenant(TenantOptions{Resolvers: []TenantResolver{TenantFromSubdomain("example.com")}}), cache.Middleware())
+	e.Group("/api/v1").GET("/books", bookResourceType, func(c *gin.Context) {
+		tenant, _ := TenantFrom(c)
+		c.JSON(http.StatusOK, gin.H{"tenant": tenant})
+	})
+
+	do := func(host string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/books", nil)
+		req.Host = host
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	do("acme.example.com")
+	w := do("acme.example.com")
+	assert.Equal(t, "HIT", w.Header().Get(HeaderXCache))
+	assert.JSONEq(t, `{"tenant":"acme"}`, w.Body.String())
+
+	w = do("globex.example.com")
+	assert.Equal(t, "MISS", w.Header().Get(HeaderXCache))
+	assert.JSONEq(t, `{"tenant":"globex"}`, w.Body.String())
+}
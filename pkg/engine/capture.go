@@ -0,0 +1,375 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/log"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderDebugCapture forces the capture of a request on a route where
+	// capture is enabled.
+	HeaderDebugCapture = "X-Debug-Capture"
+
+	defaultCaptureBodySize   = 16 << 10
+	defaultCaptureBufferSize = 100
+)
+
+// CaptureResourceType is bound to the capture admin routes.
+var CaptureResourceType = ResourceType{
+	Scope:    ResourceScope("system"),
+	Resource: "capture",
+}
+
+// CaptureRecord is a captured request and its response.
+type CaptureRecord struct {
+	Time         time.Time     `json:"time"`
+	RequestID    string        `json:"request_id"`
+	Method       string        `json:"method"`
+	Path         string        `json:"path"`
+	Route        string        `json:"route"`
+	Scope        string        `json:"scope"`
+	Resource     string        `json:"resource"`
+	Status       int           `json:"status"`
+	Latency      time.Duration `json:"latency"`
+	RequestBody  string        `json:"request_body,omitempty"`
+	ResponseBody string        `json:"response_body,omitempty"`
+	Truncated    bool          `json:"truncated,omitempty"`
+}
+
+// CaptureOptions configures a Capture.
+type CaptureOptions struct {
+	// MaxBodySize caps the captured bodies, 16KiB by default.
+	MaxBodySize int
+	// RedactPaths are the JSON paths redacted from the bodies, the
+	// segments are separated by dots and "*" matches any key or index,
+	// e.g. "user.password" or "items.*.token". If empty, the sensitive
+	// keys redacted from the audit events are redacted at any depth. The
+	// bodies which are not valid JSON, e.g. the truncated ones, are kept
+	// with the values of the last keys of the paths scrubbed, as JSON or
+	// form fields, unless a path ends with "*" or an index.
+	RedactPaths []string
+	// Header forces the capture if it's set to a true value,
+	// "X-Debug-Capture" by default.
+	Header string
+	// Logger writes the captures if it's set.
+	Logger *log.Logger
+	// BufferSize is the number of captures kept in memory, 100 by default.
+	BufferSize int
+}
+
+// Capture records the bodies of the requests and responses of the routes
+// it's enabled for, it's meant for debugging and is off for every route
+// until enabled at runtime.
+type Capture struct {
+	engine *Engine
+	opts   CaptureOptions
+	paths  [][]string
+	// jsonFields and formFields match the redacted fields of the bodies
+	// which can't be decoded, they are nil if the fields aren't known.
+	jsonFields *regexp.Regexp
+	formFields *regexp.Regexp
+
+	mutex     sync.RWMutex
+	routes    map[string]int
+	resources map[ResourceType]int
+	records   []CaptureRecord
+	next      int
+	full      bool
+}
+
+// NewCapture creates a Capture for the routes of e.
+func (e *Engine) NewCapture(opts CaptureOptions) *Capture {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultCaptureBodySize
+	}
+	if opts.Header == "" {
+		opts.Header = HeaderDebugCapture
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultCaptureBufferSize
+	}
+
+	paths := make([][]string, 0, len(opts.RedactPaths))
+	fields := defaultRedactFields
+	if len(opts.RedactPaths) > 0 {
+		fields = make([]string, 0, len(opts.RedactPaths))
+	}
+	for _, p := range opts.RedactPaths {
+		path := strings.Split(strings.TrimPrefix(p, "$."), ".")
+		paths = append(paths, path)
+		fields = append(fields, path[len(path)-1])
+	}
+	c := &Capture{
+		engine:    e,
+		opts:      opts,
+		paths:     paths,
+		routes:    make(map[string]int),
+		resources: make(map[ResourceType]int),
+		records:   make([]CaptureRecord, opts.BufferSize),
+	}
+	c.jsonFields, c.formFields = fieldPatterns(fields)
+	return c
+}
+
+// fieldPatterns returns the patterns matching the values of fields in JSON
+// and form bodies, or nil if a field is a wildcard or an index.
+func fieldPatterns(fields []string) (*regexp.Regexp, *regexp.Regexp) {
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if _, err := strconv.Atoi(f); err == nil || f == "*" {
+			return nil, nil
+		}
+		names = append(names, regexp.QuoteMeta(f))
+	}
+	name := "(?:" + strings.Join(names, "|") + ")"
+	return regexp.MustCompile(`(?i)("` + name + `"\s*:\s*)(?:"(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`),
+		regexp.MustCompile(`(?i)((?:^|&)` + name + `=)[^&]*`)
+}
+
+// EnableRoute captures percentage percent of the requests of a route, the
+// requests with the capture header are always captured.
+func (c *Capture) EnableRoute(method string, path string, percentage int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.routes[FormatRoute(method, path)] = percentage
+}
+
+// DisableRoute stops capturing a route.
+func (c *Capture) DisableRoute(method string, path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.routes, FormatRoute(method, path))
+}
+
+// EnableResource captures percentage percent of the requests of the
+// routes bound to typ, the requests with the capture header are always
+// captured.
+func (c *Capture) EnableResource(typ ResourceType, percentage int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.resources[typ] = percentage
+}
+
+// DisableResource stops capturing the routes bound to typ.
+func (c *Capture) DisableResource(typ ResourceType) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.resources, typ)
+}
+
+// Records returns the captures kept in memory, the oldest first.
+func (c *Capture) Records() []CaptureRecord {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if !c.full {
+		return append([]CaptureRecord{}, c.records[:c.next]...)
+	}
+	return append(append([]CaptureRecord{}, c.records[c.next:]...), c.records[:c.next]...)
+}
+
+// Reset drops the captures kept in memory.
+func (c *Capture) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	clear(c.records)
+	c.next = 0
+	c.full = false
+}
+
+func (c *Capture) add(r CaptureRecord) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.records[c.next] = r
+	c.next = (c.next + 1) % len(c.records)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// percentage returns the share of the requests of a route to capture, the
+// route rules take precedence over the resource ones.
+func (c *Capture) percentage(route string, typ ResourceType, matched bool) (int, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if p, ok := c.routes[route]; ok {
+		return p, true
+	}
+	if !matched {
+		return 0, false
+	}
+	p, ok := c.resources[typ]
+	return p, ok
+}
+
+// Middleware returns a middleware which captures the requests of the
+// routes capture is enabled for.
+func (c *Capture) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route := FormatRoute(ctx.Request.Method, ctx.FullPath())
+		typ, matched := c.engine.ResourceTypeOf(ctx)
+		percentage, ok := c.percentage(route, typ, matched)
+		if !ok {
+			ctx.Next()
+			return
+		}
+		forced, _ := strconv.ParseBool(ctx.GetHeader(c.opts.Header))
+		if !forced && (percentage <= 0 || rand.Intn(100) >= percentage) {
+			ctx.Next()
+			return
+		}
+
+		start := time.Now()
+		var reqBody []byte
+		if ctx.Request.Body != nil {
+			reqBody = captureBody(ctx.Request, c.opts.MaxBodySize+1)
+		}
+		w := &cappedWriter{ResponseWriter: ctx.Writer, max: c.opts.MaxBodySize + 1}
+		ctx.Writer = w
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+
+		respBody := w.body.Bytes()
+		truncated := len(reqBody) > c.opts.MaxBodySize || len(respBody) > c.opts.MaxBodySize
+		if len(reqBody) > c.opts.MaxBodySize {
+			reqBody = reqBody[:c.opts.MaxBodySize]
+		}
+		if len(respBody) > c.opts.MaxBodySize {
+			respBody = respBody[:c.opts.MaxBodySize]
+		}
+
+		record := CaptureRecord{
+			Time:         start,
+			RequestID:    RequestIDFrom(ctx),
+			Method:       ctx.Request.Method,
+			Path:         ctx.Request.URL.Path,
+			Route:        ctx.FullPath(),
+			Scope:        string(typ.Scope),
+			Resource:     typ.Resource,
+			Status:       ctx.Writer.Status(),
+			Latency:      time.Since(start),
+			RequestBody:  c.redact(reqBody),
+			ResponseBody: c.redact(respBody),
+			Truncated:    truncated,
+		}
+		c.add(record)
+
+		if c.opts.Logger != nil {
+			c.opts.Logger.Infow("capture",
+				zap.String("request_id", record.RequestID),
+				zap.String("method", record.Method),
+				zap.String("path", record.Path),
+				zap.String("route", record.Route),
+				zap.Int("status", record.Status),
+				zap.Duration("latency", record.Latency),
+				zap.String("request_body", record.RequestBody),
+				zap.String("response_body", record.ResponseBody),
+				zap.Bool("truncated", record.Truncated))
+		}
+	}
+}
+
+// redact replaces the values at the redacted paths of a JSON body, or the
+// sensitive keys if there is no path. Bodies which are not valid JSON,
+// e.g. the truncated ones, are scrubbed.
+func (c *Capture) redact(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return c.scrub(body)
+	}
+	if len(c.paths) == 0 {
+		v = redactValue(v, defaultRedactFields)
+	}
+	for _, p := range c.paths {
+		v = redactPath(v, p)
+	}
+	p, err := json.Marshal(v)
+	if err != nil {
+		return redactedValue
+	}
+	return string(p)
+}
+
+// scrub replaces the values of the redacted fields found in a body which
+// can't be decoded, the body is dropped if the fields aren't known.
+func (c *Capture) scrub(body []byte) string {
+	if c.jsonFields == nil {
+		return redactedValue
+	}
+	s := c.jsonFields.ReplaceAllString(string(body), "${1}"+strconv.Quote(redactedValue))
+	return c.formFields.ReplaceAllString(s, "${1}"+redactedValue)
+}
+
+func redactPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return redactedValue
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if path[0] == "*" || path[0] == k {
+				t[k] = redactPath(val, path[1:])
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				t[i] = redactPath(t[i], path[1:])
+			}
+		}
+	}
+	return v
+}
+
+// cappedWriter records the first max bytes of the response.
+type cappedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+	max  int
+}
+
+func (w *cappedWriter) record(p []byte) {
+	if room := w.max - w.body.Len(); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		w.body.Write(p)
+	}
+}
+
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	w.record(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cappedWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// MountCapture registers GET /captures, listing the captures kept in
+// memory, and DELETE /captures, dropping them, under the group.
+func (rg RouterGroupWrapper) MountCapture(c *Capture) {
+	rg.GET("/captures", CaptureResourceType, func(ctx *gin.Context) {
+		OK(ctx, c.Records())
+	})
+	rg.DELETE("/captures", CaptureResourceType, func(ctx *gin.Context) {
+		c.Reset()
+		ctx.Status(http.StatusNoContent)
+	})
+}
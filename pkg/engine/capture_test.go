@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	logger, fws := newTestLogger(t)
+	e := New()
+	c := e.NewCapture(CaptureOptions{
+		MaxBodySize: 64,
+		RedactPaths: []string{"$.password", "items.*.token"},
+		Logger:      logger,
+		BufferSize:  2,
+	})
+	e.Use(c.Middleware())
+
+	group := e.Group("/api/v1")
+	group.POST("/users", userResourceType, func(c *gin.Context) {
+		var body map[string]interface{}
+		_ = c.BindJSON(&body)
+		c.JSON(http.StatusCreated, body)
+	})
+	group.GET("/books/:book_id", bookResourceType, func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("b", 100))
+	})
+	e.Group("/admin").MountCapture(c)
+
+	do := func(method, path, body string, force bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if force {
+			req.Header.Set(HeaderDebugCapture, "1")
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	body := `{"name":"alex","password":"p","items":[{"token":"t"}]}`
+	w := do(http.MethodPost, "/api/v1/users", body, false)
+	assert.JSONEq(t, body, w.Body.String())
+	assert.Empty(t, c.Records())
+
+	c.EnableResource(userResourceType, 100)
+	w = do(http.MethodPost, "/api/v1/users", body, false)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, body, w.Body.String())
+
+	records := c.Records()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "/api/v1/users", records[0].Route)
+	assert.Equal(t, "user", records[0].Resource)
+	assert.Equal(t, http.StatusCreated, records[0].Status)
+	redacted := `{"name":"alex","password":"[REDACTED]","items":[{"token":"[REDACTED]"}]}`
+	assert.JSONEq(t, redacted, records[0].RequestBody)
+	assert.JSONEq(t, redacted, records[0].ResponseBody)
+	assert.Contains(t, fws.buf.String(), `"message":"capture"`)
+	assert.NotContains(t, fws.buf.String(), `password\":\"p\"`)
+
+	c.EnableRoute(http.MethodGet, "/api/v1/books/:book_id", 0)
+	do(http.MethodGet, "/api/v1/books/1", "", false)
+	assert.Len(t, c.Records(), 1)
+	do(http.MethodGet, "/api/v1/books/1", "", true)
+	records = c.Records()
+	assert.Len(t, records, 2)
+	assert.True(t, records[1].Truncated)
+	assert.Equal(t, strings.Repeat("b", 64), records[1].ResponseBody)
+
+	c.DisableResource(userResourceType)
+	do(http.MethodPost, "/api/v1/users", body, true)
+	do(http.MethodGet, "/api/v1/books/2", "", true)
+	records = c.Records()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "/api/v1/books/1", records[0].Path)
+	assert.Equal(t, "/api/v1/books/2", records[1].Path)
+
+	w = do(http.MethodGet, "/admin/captures", "", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data []CaptureRecord `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Data, 2)
+
+	c.DisableRoute(http.MethodGet, "/api/v1/books/:book_id")
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/captures", "", false).Code)
+	do(http.MethodGet, "/api/v1/books/3", "", true)
+	assert.Empty(t, c.Records())
+	for _, r := range c.records {
+		assert.Empty(t, r.ResponseBody, "reset must drop the bodies")
+	}
+}
+
+func TestCaptureDefaultRedaction(t *testing.T) {
+	e := New()
+	c := e.NewCapture(CaptureOptions{MaxBodySize: 64})
+	e.Use(c.Middleware())
+	e.Group("/api/v1").POST("/users", userResourceType, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	c.EnableResource(userResourceType, 100)
+
+	do := func(body string) CaptureRecord {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(body)))
+		records := c.Records()
+		return records[len(records)-1]
+	}
+
+	record := do(`{"name":"alex","user":{"Password":"p"}}`)
+	assert.JSONEq(t, `{"name":"alex","user":{"Password":"[REDACTED]"}}`, record.RequestBody)
+
+	// the truncated and the form bodies keep their content, scrubbed
+	record = do(`{"token": "t1","items":[{"secret":"s\"1"}],"id":1,"password":"p1234567890"}`)
+	assert.True(t, record.Truncated)
+	assert.Equal(t, `{"token": "[REDACTED]","items":[{"secret":"[REDACTED]"}],"id":1,"password":"[REDACTED]"`, record.RequestBody)
+	record = do(`name=alex&password=p&token=t`)
+	assert.Equal(t, `name=alex&password=[REDACTED]&token=[REDACTED]`, record.RequestBody)
+
+	c = e.NewCapture(CaptureOptions{RedactPaths: []string{"items.*"}})
+	assert.Equal(t, "[REDACTED]", c.redact([]byte(`{"items":["t`)))
+}
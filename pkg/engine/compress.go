@@ -0,0 +1,357 @@
+package engine
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingBrotli  = "br"
+
+	defaultCompressMinSize    = 1024
+	defaultDecompressBodySize = 10 << 20
+)
+
+var (
+	// encoders are the supported encodings, brotli is registered if the
+	// engine is built with the brotli tag.
+	encoders = map[string]func(w io.Writer, level int) (compressor, error){
+		EncodingGzip: func(w io.Writer, level int) (compressor, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		EncodingDeflate: func(w io.Writer, level int) (compressor, error) {
+			return flate.NewWriter(w, level)
+		},
+	}
+
+	// defaultExcludedContentTypes are already compressed or streamed.
+	defaultExcludedContentTypes = []string{
+		"image/*", "video/*", "audio/*", "font/woff2",
+		"application/zip", "application/gzip", "application/octet-stream",
+		"text/event-stream",
+	}
+)
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// CompressOptions configures the Compress middleware.
+type CompressOptions struct {
+	// Encodings are the encodings in the order of preference, used to break
+	// the ties of Accept-Encoding. Brotli, if built in, gzip and deflate by
+	// default.
+	Encodings []string
+	// Level is the compression level, the default level of every encoding
+	// if zero.
+	Level int
+	// MinSize is the size a response must reach to be compressed, 1KiB by
+	// default.
+	MinSize int
+	// ExcludedContentTypes are never compressed, "type/*" matches every
+	// subtype. Images, videos, audios, archives and event streams by
+	// default.
+	ExcludedContentTypes []string
+	// MaxBodySize caps the decompressed request bodies, by default it's
+	// the limit of the BodyLimit middleware in front, or 10MiB without.
+	MaxBodySize int64
+}
+
+// Compress returns a middleware which compresses the responses with the
+// encoding negotiated by Accept-Encoding, and decompresses the request
+// bodies sent with Content-Encoding gzip or deflate. The responses are
+// buffered until they reach MinSize, a flush, e.g. by a streaming handler,
+// sends what was written so far.
+func Compress(opts CompressOptions) gin.HandlerFunc {
+	if len(opts.Encodings) == 0 {
+		for _, enc := range []string{EncodingBrotli, EncodingGzip, EncodingDeflate} {
+			if _, ok := encoders[enc]; ok {
+				opts.Encodings = append(opts.Encodings, enc)
+			}
+		}
+	}
+	if opts.Level == 0 {
+		opts.Level = -1
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultCompressMinSize
+	}
+	if opts.ExcludedContentTypes == nil {
+		opts.ExcludedContentTypes = defaultExcludedContentTypes
+	}
+
+	return func(ctx *gin.Context) {
+		max := opts.MaxBodySize
+		if max <= 0 {
+			max = bodyLimit(ctx)
+		}
+		if err := decompressBody(ctx, max); err != nil {
+			Fail(ctx, response.ErrBadRequest.WithMessage("invalid compressed body"))
+			return
+		}
+
+		encoding := negotiateEncoding(ctx.GetHeader("Accept-Encoding"), opts.Encodings)
+		if encoding == "" || ctx.Request.Method == http.MethodHead {
+			ctx.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: ctx.Writer, opts: &opts, encoding: encoding, size: -1}
+		ctx.Writer = w
+		defer func() {
+			ctx.Writer = w.ResponseWriter
+		}()
+		ctx.Next()
+		w.finish()
+	}
+}
+
+// bodyLimit returns the limit set by the BodyLimit middleware, or the
+// default size of the decompressed bodies.
+func bodyLimit(ctx *gin.Context) int64 {
+	if max, ok := ctx.Get(bodyLimitContextKey); ok {
+		return max.(int64)
+	}
+	return defaultDecompressBodySize
+}
+
+// decompressBody replaces a compressed request body by the decompressed
+// one, reading past max fails with http.MaxBytesError.
+func decompressBody(ctx *gin.Context, max int64) error {
+	req := ctx.Request
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0 {
+		return nil
+	}
+	var r io.ReadCloser
+	switch strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding"))) {
+	case EncodingGzip:
+		gr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return err
+		}
+		r = gr
+	case EncodingDeflate:
+		r = flate.NewReader(req.Body)
+	default:
+		return nil
+	}
+
+	req.Body = http.MaxBytesReader(ctx.Writer, readCloser{Reader: r, Closer: req.Body}, max)
+	req.Header.Del("Content-Encoding")
+	req.Header.Del("Content-Length")
+	req.ContentLength = -1
+	return nil
+}
+
+// negotiateEncoding returns the supported encoding with the highest
+// quality in the Accept-Encoding header, "" if none is acceptable.
+func negotiateEncoding(accept string, supported []string) string {
+	if accept == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supported {
+		q, ok := qualities[enc]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+func contentTypeExcluded(contentType string, excluded []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, ex := range excluded {
+		if strings.HasSuffix(ex, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(ex, "*")) {
+			return true
+		}
+		if strings.EqualFold(ex, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the response until it's known whether it should
+// be compressed, then writes it through the encoder or as it is.
+type compressWriter struct {
+	gin.ResponseWriter
+	opts     *CompressOptions
+	encoding string
+
+	status  int
+	size    int
+	buf     bytes.Buffer
+	decided bool
+	enc     compressor
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if w.size < 0 {
+		w.size = 0
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+}
+
+func (w *compressWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *compressWriter) Size() int {
+	return w.size
+}
+
+func (w *compressWriter) Written() bool {
+	return w.size >= 0
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	w.WriteHeaderNow()
+	w.size += len(p)
+	if !w.decided {
+		w.buf.Write(p)
+		if w.buf.Len() < w.opts.MinSize {
+			return len(p), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush sends what was written so far, a response which hasn't reached
+// MinSize yet is sent uncompressed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.WriteHeaderNow()
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide writes the header and the buffered body, compressing it if it's
+// large enough and its content type is not excluded.
+func (w *compressWriter) decide() error {
+	w.decided = true
+	h := w.Header()
+	status := w.Status()
+
+	hasBody := w.buf.Len() > 0 &&
+		status != http.StatusNoContent && status != http.StatusNotModified && status >= http.StatusOK
+	compress := hasBody && w.buf.Len() >= w.opts.MinSize && h.Get("Content-Encoding") == ""
+	if ct := h.Get("Content-Type"); ct == "" && hasBody {
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+	if contentTypeExcluded(h.Get("Content-Type"), w.opts.ExcludedContentTypes) {
+		compress = false
+	} else {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	if compress {
+		enc, err := encoders[w.encoding](w.ResponseWriter, w.opts.Level)
+		if err != nil {
+			compress = false
+		} else {
+			w.enc = enc
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.WriteHeaderNow()
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressWriter) finish() {
+	if !w.decided {
+		if w.size < 0 {
+			// nothing was written, leave the response to the outer writers
+			if w.status != 0 {
+				w.ResponseWriter.WriteHeader(w.status)
+			}
+			return
+		}
+		_ = w.decide()
+	}
+	if w.enc != nil {
+		_ = w.enc.Close()
+	}
+}
@@ -0,0 +1,18 @@
+//go:build brotli
+
+package engine
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+func init() {
+	encoders[EncodingBrotli] = func(w io.Writer, level int) (compressor, error) {
+		if level < 0 {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level), nil
+	}
+}
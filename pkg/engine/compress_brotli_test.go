@@ -0,0 +1,34 @@
+//go:build brotli
+
+package engine
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressBrotli(t *testing.T) {
+	large := strings.Repeat("brotli ", 500)
+
+	e := New()
+	e.Use(Compress(CompressOptions{}))
+	e.Group("/api/v1").GET("/books", bookResourceType, func(c *gin.Context) {
+		c.String(http.StatusOK, large)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/books", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, EncodingBrotli, w.Header().Get("Content-Encoding"))
+	body, err := io.ReadAll(brotli.NewReader(w.Body))
+	assert.Nil(t, err)
+	assert.Equal(t, large, string(body))
+}
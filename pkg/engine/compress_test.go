@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{EncodingGzip, EncodingDeflate}
+	assert.Equal(t, "", negotiateEncoding("", supported))
+	assert.Equal(t, EncodingGzip, negotiateEncoding("gzip, deflate", supported))
+	assert.Equal(t, EncodingDeflate, negotiateEncoding("gzip;q=0.5, deflate", supported))
+	assert.Equal(t, EncodingGzip, negotiateEncoding("*", supported))
+	assert.Equal(t, EncodingDeflate, negotiateEncoding("gzip;q=0, *;q=0.1", supported))
+	assert.Equal(t, "", negotiateEncoding("identity, br", supported))
+}
+
+func TestCompressNotModified(t *testing.T) {
+	e := New()
+	e.Use(Compress(CompressOptions{}), ETag())
+	e.Group("/api/v1").GET("/users", userResourceType, func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("alex", 1000))
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+
+	w2 := httptest.NewRecorder()
+	req.Header.Set(HeaderIfNoneMatch, w.Header().Get(HeaderETag))
+	e.ServeHTTP(w2, req)
+	assert.Equal(t, http.StatusNotModified, w2.Code)
+	assert.Empty(t, w2.Header().Get("Content-Type"))
+	assert.Empty(t, w2.Header().Get("Content-Encoding"))
+	assert.Empty(t, w2.Body.String())
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"alex"},`, 200)
+
+	e := New()
+	e.Use(ErrorHandler(), Compress(CompressOptions{MaxBodySize: 64}))
+
+	group := e.Group("/api/v1")
+	group.GET("/users", userResourceType, func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(large))
+	})
+	group.GET("/users/:user_id", userResourceType, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("user_id")})
+	})
+	group.GET("/books/cover", bookResourceType, func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(large))
+	})
+	group.DELETE("/users/:user_id", userResourceType, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	group.POST("/users", userResourceType, func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	})
+
+	do := func(method, path, encoding string, body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Accept-Encoding", encoding)
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/api/v1/users", "gzip", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Less(t, w.Body.Len(), len(large))
+	gr, err := gzip.NewReader(w.Body)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(gr)
+	assert.Nil(t, err)
+	assert.Equal(t, large, string(body))
+
+	w = do(http.MethodGet, "/api/v1/users", "deflate", nil)
+	assert.Equal(t, EncodingDeflate, w.Header().Get("Content-Encoding"))
+	body, err = io.ReadAll(flate.NewReader(w.Body))
+	assert.Nil(t, err)
+	assert.Equal(t, large, string(body))
+
+	w = do(http.MethodGet, "/api/v1/users", "", nil)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, w.Body.String())
+
+	w = do(http.MethodGet, "/api/v1/users/1", "gzip", nil)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.JSONEq(t, `{"id":"1"}`, w.Body.String())
+
+	w = do(http.MethodGet, "/api/v1/books/cover", "gzip", nil)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	w = do(http.MethodDelete, "/api/v1/users/1", "gzip", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Empty(t, w.Header().Get("Content-Type"))
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, _ = gw.Write([]byte("hello"))
+	_ = gw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+
+	compressed.Reset()
+	gw = gzip.NewWriter(&compressed)
+	_, _ = gw.Write([]byte(large))
+	_ = gw.Close()
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader("not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// an empty body is not decompressed
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/users", nil)
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestDecompressBodyLimit(t *testing.T) {
+	e := New()
+	e.Use(ErrorHandler(), BodyLimit(1024), Compress(CompressOptions{}))
+	e.Group("/api/v1").POST("/users", userResourceType, func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.String(http.StatusOK, "%d", len(body))
+	})
+
+	do := func(size int) *httptest.ResponseRecorder {
+		var compressed bytes.Buffer
+		gw := gzip.NewWriter(&compressed)
+		_, _ = gw.Write(bytes.Repeat([]byte("a"), size))
+		_ = gw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users", &compressed)
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(1024)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1024", w.Body.String())
+	// the compressed body is far below the limit, the decompressed one isn't
+	assert.Equal(t, http.StatusRequestEntityTooLarge, do(64<<10).Code)
+}
+
+func TestCompressStreaming(t *testing.T) {
+	e := New()
+	e.Use(Compress(CompressOptions{MinSize: 16}))
+	hub := e.NewHub(HubOptions{})
+	group := e.Group("/api/v1")
+	group.SSE("/events", bookResourceType, hub, StaticTopic("books"))
+	group.GET("/stream", bookResourceType, func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain")
+		for i := 0; i < 3; i++ {
+			_, _ = c.Writer.WriteString(strings.Repeat("x", 32) + "\n")
+			c.Writer.Flush()
+		}
+	})
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, EncodingGzip, resp.Header.Get("Content-Encoding"))
+	gr, err := gzip.NewReader(resp.Body)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(gr)
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat(strings.Repeat("x", 32)+"\n", 3), string(body))
+	_ = resp.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/api/v1/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = http.DefaultTransport.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Eventually(t, func() bool { return hub.Subscribers("books") == 1 }, time.Second, 5*time.Millisecond)
+	hub.Publish("books", Event{Data: strings.Repeat("y", 64)})
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "id: 1\n", line)
+	_ = resp.Body.Close()
+	hub.Close()
+}
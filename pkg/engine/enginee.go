@@ -5,6 +5,10 @@ import (
 	"net/http"
 	"path"
 	"sync"
+	"sync/atomic"
+
+	"github.com/daemgo/gopkg/pkg/id"
+	"github.com/daemgo/gopkg/pkg/log"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,11 +18,23 @@ type Engine struct {
 
 	mutex   sync.RWMutex
 	Routers map[string]ResourceType
+
+	routeMeta   map[string]RouteMeta
+	logger      *log.Logger
+	idGenerator id.IDGenerator
+	lifecycle   lifecycle
+	timeouts    atomic.Bool
+	versioning  *VersionOptions
+
+	registrations []routeRegistration
+	timedRoutes   []routeRegistration
+	strictRoutes  bool
 }
 
 type RouterGroupWrapper struct {
 	*gin.RouterGroup
 	engine *Engine
+	meta   RouteMeta
 }
 
 // ResourceScope is the scope of the resource.
@@ -32,11 +48,88 @@ type ResourceType struct {
 	Resource string `json:"resource"`
 }
 
-func New() *Engine {
-	return &Engine{
-		Engine:  gin.New(),
-		Routers: make(map[string]ResourceType),
+// New creates a bare Engine, the default middleware stack is installed
+// only if WithDefaultMiddlewares is provided.
+func New(opts ...Option) *Engine {
+	o := &options{}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+
+	if o.logger == nil {
+		o.logger = log.DefaultLogger
+	}
+	RegisterValidators()
+
+	e := &Engine{
+		Engine:      gin.New(),
+		Routers:     make(map[string]ResourceType),
+		routeMeta:   make(map[string]RouteMeta),
+		logger:      o.logger,
+		idGenerator: o.idGenerator,
+	}
+	e.strictRoutes = o.strictRoutes
+	if err := e.Engine.SetTrustedProxies(o.trustedProxies); err != nil {
+		panic(err)
+	}
+
+	if o.defaultMiddlewares {
+		if e.idGenerator == nil {
+			gen, err := id.NewIDGenerator()
+			if err != nil {
+				panic(err)
+			}
+			e.idGenerator = gen
+		}
+		e.Use(RequestID(e.idGenerator), e.AccessLog(), Recovery(e.logger), ErrorHandler())
+	}
+	return e
+}
+
+// Default creates an Engine with the default middleware stack installed.
+func Default(opts ...Option) *Engine {
+	return New(append(opts, WithDefaultMiddlewares())...)
+}
+
+// Logger returns the logger used by the engine.
+func (e *Engine) Logger() *log.Logger {
+	return e.logger
+}
+
+// RouteMetaOf returns the RouteMeta registered for the route matched by
+// the request.
+func (e *Engine) RouteMetaOf(ctx *gin.Context) (RouteMeta, bool) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	meta, ok := e.routeMeta[FormatRoute(ctx.Request.Method, ctx.FullPath())]
+	return meta, ok
+}
+
+// ResourceTypeOf returns the ResourceType registered for the route matched
+// by the request, the second return value reports whether it was found.
+func (e *Engine) ResourceTypeOf(ctx *gin.Context) (ResourceType, bool) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	typ, ok := e.Routers[FormatRoute(ctx.Request.Method, ctx.FullPath())]
+	return typ, ok
+}
+
+// ServeHTTP rewrites the path of the requests negotiating a version and
+// serves them with the gin engine.
+func (e *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if e.versioning != nil {
+		if err := e.versioning.rewriteVersion(req); err != nil {
+			e.setRequestID(w, req)
+			writeAPIError(w, err)
+			return
+		}
+	}
+
+	if e.hasTimeout(req) {
+		e.serveWithTimeout(w, req)
+		return
 	}
+	e.Engine.ServeHTTP(w, req)
 }
 
 func FormatRoute(method string, path string) string {
@@ -50,50 +143,47 @@ func (e *Engine) Group(relativePath string, handlers ...gin.HandlerFunc) RouterG
 
 func (rg RouterGroupWrapper) Group(relativePath string, handlers ...gin.HandlerFunc) RouterGroupWrapper {
 	group := rg.RouterGroup.Group(relativePath, handlers...)
-	return RouterGroupWrapper{RouterGroup: group, engine: rg.engine}
+	return RouterGroupWrapper{RouterGroup: group, engine: rg.engine, meta: rg.meta}
 }
 
-func (rg RouterGroupWrapper) GET(relativePath string, typ ResourceType, handlers ...gin.HandlerFunc) gin.IRoutes {
+func (rg RouterGroupWrapper) handle(method string, relativePath string, typ ResourceType, handlers []gin.HandlerFunc) gin.IRoutes {
 	absolutePath := path.Join(rg.BasePath(), relativePath)
+	key := FormatRoute(method, absolutePath)
+	reg := routeRegistration{method: method, path: joinPaths(rg.BasePath(), relativePath), typ: typ}
 	rg.engine.mutex.Lock()
 	defer rg.engine.mutex.Unlock()
-	rg.engine.Routers[FormatRoute(http.MethodGet, absolutePath)] = typ
 
-	return rg.RouterGroup.GET(relativePath, handlers...)
+	if rg.engine.strictRoutes {
+		if err := conflictsWith(reg, rg.engine.registrations); err != nil {
+			panic(err)
+		}
+	}
+	routes := rg.RouterGroup.Handle(method, relativePath, handlers...)
+	rg.engine.Routers[key] = typ
+	rg.engine.routeMeta[key] = rg.meta
+	rg.engine.registrations = append(rg.engine.registrations, reg)
+	if rg.meta.Timeout > 0 {
+		rg.engine.timedRoutes = append(rg.engine.timedRoutes, reg)
+	}
+	return routes
 }
 
-func (rg RouterGroupWrapper) POST(relativePath string, typ ResourceType, handlers ...gin.HandlerFunc) gin.IRoutes {
-	absolutePath := path.Join(rg.BasePath(), relativePath)
-	rg.engine.mutex.Lock()
-	defer rg.engine.mutex.Unlock()
-	rg.engine.Routers[FormatRoute(http.MethodPost, absolutePath)] = typ
+func (rg RouterGroupWrapper) GET(relativePath string, typ ResourceType, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return rg.handle(http.MethodGet, relativePath, typ, handlers)
+}
 
-	return rg.RouterGroup.POST(relativePath, handlers...)
+func (rg RouterGroupWrapper) POST(relativePath string, typ ResourceType, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return rg.handle(http.MethodPost, relativePath, typ, handlers)
 }
 
 func (rg RouterGroupWrapper) PATCH(relativePath string, typ ResourceType, handlers ...gin.HandlerFunc) gin.IRoutes {
-	absolutePath := path.Join(rg.BasePath(), relativePath)
-	rg.engine.mutex.Lock()
-	defer rg.engine.mutex.Unlock()
-	rg.engine.Routers[FormatRoute(http.MethodPatch, absolutePath)] = typ
-
-	return rg.RouterGroup.PATCH(relativePath, handlers...)
+	return rg.handle(http.MethodPatch, relativePath, typ, handlers)
 }
 
 func (rg RouterGroupWrapper) PUT(relativePath string, typ ResourceType, handlers ...gin.HandlerFunc) gin.IRoutes {
-	absolutePath := path.Join(rg.BasePath(), relativePath)
-	rg.engine.mutex.Lock()
-	defer rg.engine.mutex.Unlock()
-	rg.engine.Routers[FormatRoute(http.MethodPut, absolutePath)] = typ
-
-	return rg.RouterGroup.PUT(relativePath, handlers...)
+	return rg.handle(http.MethodPut, relativePath, typ, handlers)
 }
 
 func (rg RouterGroupWrapper) DELETE(relativePath string, typ ResourceType, handlers ...gin.HandlerFunc) gin.IRoutes {
-	absolutePath := path.Join(rg.BasePath(), relativePath)
-	rg.engine.mutex.Lock()
-	defer rg.engine.mutex.Unlock()
-	rg.engine.Routers[FormatRoute(http.MethodDelete, absolutePath)] = typ
-
-	return rg.RouterGroup.DELETE(relativePath, handlers...)
+	return rg.handle(http.MethodDelete, relativePath, typ, handlers)
 }
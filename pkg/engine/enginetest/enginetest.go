@@ -0,0 +1,273 @@
+package enginetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/daemgo/gopkg/pkg/engine"
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type principalKey struct{}
+
+// Authenticate returns a test-only middleware which authenticates the
+// requests sent with a principal by a Client as that principal, the other
+// requests are authenticated by engine.Authenticate with opts. Wire it in
+// place of engine.Authenticate when the engine is built by the tests.
+func Authenticate(opts engine.AuthOptions) gin.HandlerFunc {
+	authenticate := engine.Authenticate(opts)
+	return func(ctx *gin.Context) {
+		if p, ok := ctx.Request.Context().Value(principalKey{}).(*engine.Principal); ok {
+			engine.SetPrincipal(ctx, p)
+			ctx.Next()
+			return
+		}
+		authenticate(ctx)
+	}
+}
+
+// Client sends in-process requests to an engine.
+type Client struct {
+	t         testing.TB
+	engine    *engine.Engine
+	headers   http.Header
+	principal *engine.Principal
+}
+
+// New creates a Client for e.
+func New(t testing.TB, e *engine.Engine) *Client {
+	return &Client{
+		t:       t,
+		engine:  e,
+		headers: http.Header{},
+	}
+}
+
+// WithHeader sets a header sent with every request of the client.
+func (c *Client) WithHeader(key, value string) *Client {
+	c.headers.Set(key, value)
+	return c
+}
+
+// AsPrincipal makes every request of the client authenticated as p, the
+// engine must use the Authenticate middleware of this package.
+func (c *Client) AsPrincipal(p *engine.Principal) *Client {
+	c.principal = p
+	return c
+}
+
+// Do starts a request, it's sent by the first Expect call or by Send.
+func (c *Client) Do(method, path string) *Request {
+	return &Request{
+		client:    c,
+		method:    method,
+		path:      path,
+		headers:   c.headers.Clone(),
+		query:     url.Values{},
+		principal: c.principal,
+	}
+}
+
+// Request is a request built fluently and its recorded response.
+type Request struct {
+	client    *Client
+	method    string
+	path      string
+	headers   http.Header
+	query     url.Values
+	body      io.Reader
+	principal *engine.Principal
+
+	recorder *httptest.ResponseRecorder
+}
+
+// WithHeader sets a header of the request.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.headers.Set(key, value)
+	return r
+}
+
+// WithQuery adds a query parameter to the request.
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithBody sets the body of the request.
+func (r *Request) WithBody(contentType string, body io.Reader) *Request {
+	r.headers.Set("Content-Type", contentType)
+	r.body = body
+	return r
+}
+
+// WithJSON sets the body of the request to v encoded as JSON.
+func (r *Request) WithJSON(v interface{}) *Request {
+	p, err := json.Marshal(v)
+	assert.Nil(r.client.t, err, "failed to encode the request body")
+	return r.WithBody("application/json", bytes.NewReader(p))
+}
+
+// WithPrincipal authenticates the request as p, like Client.AsPrincipal.
+func (r *Request) WithPrincipal(p *engine.Principal) *Request {
+	r.principal = p
+	return r
+}
+
+// Send sends the request once and returns the recorded response.
+func (r *Request) Send() *httptest.ResponseRecorder {
+	if r.recorder != nil {
+		return r.recorder
+	}
+
+	target := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+	req := httptest.NewRequest(r.method, target, r.body)
+	for k, v := range r.headers {
+		req.Header[k] = v
+	}
+	if r.principal != nil {
+		req = req.WithContext(context.WithValue(req.Context(), principalKey{}, r.principal))
+	}
+
+	r.recorder = httptest.NewRecorder()
+	r.client.engine.ServeHTTP(r.recorder, req)
+	return r.recorder
+}
+
+// ExpectStatus asserts the status code of the response.
+func (r *Request) ExpectStatus(status int) *Request {
+	r.client.t.Helper()
+	w := r.Send()
+	assert.Equal(r.client.t, status, w.Code, "unexpected status of %s %s: %s", r.method, r.path, w.Body.String())
+	return r
+}
+
+// ExpectHeader asserts a header of the response.
+func (r *Request) ExpectHeader(key, value string) *Request {
+	r.client.t.Helper()
+	assert.Equal(r.client.t, value, r.Send().Header().Get(key), "unexpected header %s", key)
+	return r
+}
+
+// ExpectBodyContains asserts the body of the response contains s.
+func (r *Request) ExpectBodyContains(s string) *Request {
+	r.client.t.Helper()
+	assert.Contains(r.client.t, r.Send().Body.String(), s)
+	return r
+}
+
+// ExpectJSON asserts the body of the response equals to expected, which is
+// either a JSON string, JSON bytes or a value encoded as JSON.
+func (r *Request) ExpectJSON(expected interface{}) *Request {
+	r.client.t.Helper()
+	assert.JSONEq(r.client.t, toJSON(r.client.t, expected), r.Send().Body.String())
+	return r
+}
+
+// ExpectData asserts the data of the success envelope equals to expected,
+// which is handled like in ExpectJSON.
+func (r *Request) ExpectData(expected interface{}) *Request {
+	r.client.t.Helper()
+	var resp struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	r.DecodeJSON(&resp)
+	assert.True(r.client.t, resp.Success, "response is not a success")
+	assert.JSONEq(r.client.t, toJSON(r.client.t, expected), string(resp.Data))
+	return r
+}
+
+// ExpectErrorCode asserts the code of the error envelope.
+func (r *Request) ExpectErrorCode(code string) *Request {
+	r.client.t.Helper()
+	var resp response.Response
+	r.DecodeJSON(&resp)
+	if assert.NotNil(r.client.t, resp.Error, "response is not an error") {
+		assert.Equal(r.client.t, code, resp.Error.Code)
+	}
+	return r
+}
+
+// DecodeJSON decodes the body of the response into v.
+func (r *Request) DecodeJSON(v interface{}) *Request {
+	r.client.t.Helper()
+	err := json.Unmarshal(r.Send().Body.Bytes(), v)
+	assert.Nil(r.client.t, err, "failed to decode the response body: %s", r.Send().Body.String())
+	return r
+}
+
+func toJSON(t testing.TB, v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	p, err := json.Marshal(v)
+	assert.Nil(t, err, "failed to encode the expected value")
+	return string(p)
+}
+
+// AssertRoutes asserts that every route of e is bound to a ResourceType and
+// that a request to the route, with every param set to "1", is routed to it.
+// The requests are routed by a copy of the routes with no-op handlers, so
+// the handlers of e are never called.
+func AssertRoutes(t testing.TB, e *engine.Engine) {
+	t.Helper()
+	routes := e.Routes()
+	scratch := gin.New()
+	for _, route := range routes {
+		scratch.Handle(route.Method, route.Path, func(*gin.Context) {})
+	}
+
+	for _, route := range routes {
+		// the routes are bound like in the engine, without trailing slash
+		key := engine.FormatRoute(route.Method, path.Join(route.Path))
+		typ, ok := e.Routers[key]
+		if !assert.True(t, ok, "route %s has no ResourceType", key) {
+			continue
+		}
+		assert.NotEmpty(t, typ.Scope, "route %s has an empty scope", key)
+		assert.NotEmpty(t, typ.Resource, "route %s has an empty resource", key)
+
+		matched := matchRoute(scratch, route.Method, samplePath(route.Path))
+		assert.Equal(t, route.Path, matched, "route %s is not reachable", key)
+	}
+}
+
+// samplePath fills the params of a route template.
+func samplePath(template string) string {
+	segments := strings.Split(template, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			segments[i] = "1"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// matchRoute returns the template of the route which serves the request.
+func matchRoute(g *gin.Engine, method, path string) string {
+	c := gin.CreateTestContextOnly(httptest.NewRecorder(), g)
+	c.Request = httptest.NewRequest(method, path, nil)
+	g.HandleContext(c)
+	return c.FullPath()
+}
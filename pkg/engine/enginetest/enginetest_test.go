@@ -0,0 +1,98 @@
+package enginetest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/daemgo/gopkg/pkg/engine"
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	userResourceType = engine.ResourceType{
+		Scope:    engine.ResourceScope("management"),
+		Resource: "user",
+	}
+)
+
+func newTestEngine() *engine.Engine {
+	e := engine.New()
+	e.Use(Authenticate(engine.AuthOptions{}))
+
+	group := e.Group("/api/v1")
+	group.GET("/user", userResourceType, func(ctx *gin.Context) {
+		p, _ := engine.PrincipalFrom(ctx)
+		engine.OK(ctx, gin.H{"subject": p.Subject, "tenant": ctx.Query("tenant")})
+	})
+	group.PUT("/user/:user_id", userResourceType, func(ctx *gin.Context) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			engine.Fail(ctx, response.ErrBadRequest)
+			return
+		}
+		ctx.Header("X-User-ID", ctx.Param("user_id"))
+		engine.OK(ctx, body.Name)
+	})
+	return e
+}
+
+func TestClient(t *testing.T) {
+	c := New(t, newTestEngine()).AsPrincipal(&engine.Principal{Subject: "alex"})
+
+	c.Do(http.MethodGet, "/api/v1/user").
+		WithQuery("tenant", "acme").
+		ExpectStatus(http.StatusOK).
+		ExpectData(map[string]string{"subject": "alex", "tenant": "acme"})
+
+	c.Do(http.MethodPut, "/api/v1/user/42").
+		WithJSON(map[string]string{"name": "bob"}).
+		ExpectStatus(http.StatusOK).
+		ExpectHeader("X-User-ID", "42").
+		ExpectJSON(`{"success":true,"data":"bob"}`)
+
+	c.Do(http.MethodPut, "/api/v1/user/42").
+		WithBody("application/json", nil).
+		ExpectStatus(http.StatusBadRequest).
+		ExpectErrorCode("BAD_REQUEST")
+
+	New(t, newTestEngine()).
+		Do(http.MethodGet, "/api/v1/user").
+		ExpectStatus(http.StatusUnauthorized).
+		ExpectErrorCode("UNAUTHORIZED")
+}
+
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertRoutes(t *testing.T) {
+	AssertRoutes(t, newTestEngine())
+
+	called := false
+	e := newTestEngine()
+	e.Engine.GET("/raw", func(ctx *gin.Context) {})
+	e.Group("/api/v1").GET("/panics/*path", userResourceType, func(ctx *gin.Context) {
+		called = true
+		panic("handlers must not be called")
+	})
+	e.Group("/api/v1").POST("/users/", userResourceType, func(ctx *gin.Context) {})
+
+	rt := &recordingT{TB: t}
+	AssertRoutes(rt, e)
+	assert.Len(t, rt.errors, 1)
+	assert.Contains(t, rt.errors[0], "route GET /raw has no ResourceType")
+	assert.False(t, called)
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// OK writes data in the success envelope with status 200.
+func OK(ctx *gin.Context, data interface{}) {
+	ctx.JSON(http.StatusOK, response.Success(data, RequestIDFrom(ctx)))
+}
+
+// Fail aborts the request and writes err in the error envelope, the status
+// is taken from the APIError wrapped in err or defaults to 500.
+func Fail(ctx *gin.Context, err error) {
+	apiErr := toAPIError(err)
+	ctx.AbortWithStatusJSON(apiErr.Status, response.Failure(apiErr, RequestIDFrom(ctx)))
+}
+
+// ErrorHandler returns a middleware which turns the errors pushed with
+// ctx.Error into the error envelope, if the handler hasn't written a body.
+func ErrorHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if len(ctx.Errors) == 0 || ctx.Writer.Size() > 0 {
+			return
+		}
+
+		last := ctx.Errors.Last()
+		err := last.Err
+		var maxBytesErr *http.MaxBytesError
+		if last.IsType(gin.ErrorTypeBind) && !isAPIError(err) && !errors.As(err, &maxBytesErr) {
+			err = validationError(err)
+		}
+		Fail(ctx, err)
+	}
+}
+
+// writeAPIError writes err in the error envelope outside of a gin handler,
+// the request ID is taken from the response headers.
+func writeAPIError(w http.ResponseWriter, err *response.APIError) {
+	requestID := w.Header().Get(HeaderRequestID)
+	body, _ := json.Marshal(response.Failure(err, requestID))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(err.Status)
+	_, _ = w.Write(body)
+}
+
+func isAPIError(err error) bool {
+	var apiErr *response.APIError
+	return errors.As(err, &apiErr)
+}
+
+func toAPIError(err error) *response.APIError {
+	var (
+		verrs       validator.ValidationErrors
+		maxBytesErr *http.MaxBytesError
+	)
+	if !isAPIError(err) {
+		if errors.As(err, &maxBytesErr) {
+			err = response.ErrPayloadTooLarge
+		} else if errors.As(err, &verrs) {
+			err = validationError(err)
+		}
+	}
+	return response.FromError(err)
+}
+
+// validationError converts a binding or validation error to an APIError
+// with field level details, fields are named after their json tags.
+func validationError(err error) *response.APIError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return response.ErrBadRequest.WithMessage(err.Error())
+	}
+
+	details := make([]response.FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		details = append(details, response.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return response.ErrValidation.WithDetails(details)
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	if fe.Param() != "" {
+		return fmt.Sprintf("%s failed on the '%s=%s' rule", fe.Field(), fe.Tag(), fe.Param())
+	}
+	return fmt.Sprintf("%s failed on the '%s' rule", fe.Field(), fe.Tag())
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) response.Response {
+	var resp response.Response
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp), "bad body: ", w.Body.String())
+	return resp
+}
+
+func TestEnvelope(t *testing.T) {
+	logger, _ := newTestLogger(t)
+	e := Default(WithLogger(logger), WithIDGenerator(&fakeIDGenerator{}))
+
+	type user struct {
+		Name  string `json:"name" binding:"required"`
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	group := e.Group("/api/v1")
+	group.GET("/users", userResourceType, func(c *gin.Context) {
+		OK(c, []string{"alex"})
+	})
+	group.GET("/users/:user_id", userResourceType, func(c *gin.Context) {
+		Fail(c, response.ErrNotFound.WithMessage("user not found"))
+	})
+	group.POST("/users", userResourceType, func(c *gin.Context) {
+		var u user
+		if err := c.ShouldBindJSON(&u); err != nil {
+			_ = c.Error(err).SetType(gin.ErrorTypeBind)
+			return
+		}
+		OK(c, u)
+	})
+	group.DELETE("/users/:user_id", userResourceType, func(c *gin.Context) {
+		_ = c.Error(errors.New("db is down"))
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := decodeResponse(t, w)
+	assert.True(t, resp.Success)
+	assert.Equal(t, []interface{}{"alex"}, resp.Data)
+	assert.Equal(t, "1", resp.RequestID)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	resp = decodeResponse(t, w)
+	assert.False(t, resp.Success)
+	assert.Equal(t, "NOT_FOUND", resp.Error.Code)
+	assert.Equal(t, "user not found", resp.Error.Message)
+	assert.Equal(t, "2", resp.Error.RequestID)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"name":"alex","email":"x"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	resp = decodeResponse(t, w)
+	assert.Equal(t, "VALIDATION_FAILED", resp.Error.Code)
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"field":   "email",
+		"rule":    "email",
+		"message": "email failed on the 'email' rule",
+	}}, resp.Error.Details)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/users/1", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	resp = decodeResponse(t, w)
+	assert.Equal(t, "INTERNAL_ERROR", resp.Error.Code)
+}
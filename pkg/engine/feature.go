@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"github.com/daemgo/gopkg/pkg/engine/flags"
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Flags returns a middleware which stores p and the subject of the
+// request, made of the principal and the tenant, in the request context,
+// so that the handlers can call FlagEnabled. It should be installed
+// after Authenticate and Tenant.
+func Flags(p flags.FlagProvider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c := flags.WithProvider(ctx.Request.Context(), p)
+		c = flags.WithSubject(c, flagSubject(ctx))
+		ctx.Request = ctx.Request.WithContext(c)
+		ctx.Next()
+	}
+}
+
+// flagSubject returns the subject the flags are evaluated for.
+func flagSubject(ctx *gin.Context) flags.Subject {
+	var s flags.Subject
+	if p, ok := PrincipalFrom(ctx); ok {
+		s.User = p.Subject
+		s.Tenant = p.Tenant
+	}
+	if tenant, ok := TenantFrom(ctx); ok && tenant != "" {
+		s.Tenant = tenant
+	}
+	return s
+}
+
+// FlagEnabled reports whether the flag name is on for the subject of the
+// request, it's flags.Enabled for the handlers.
+func FlagEnabled(ctx *gin.Context, name string) bool {
+	return flags.Enabled(flags.WithSubject(ctx.Request.Context(), flagSubject(ctx)), name)
+}
+
+// Feature returns a group sharing the path of rg whose routes respond 404
+// while the feature flag name is off, as if they didn't exist.
+func (rg RouterGroupWrapper) Feature(name string) RouterGroupWrapper {
+	group := rg.Group("", func(ctx *gin.Context) {
+		if !FlagEnabled(ctx, name) {
+			Fail(ctx, response.ErrNotFound)
+			return
+		}
+		ctx.Next()
+	})
+	group.meta.Feature = name
+	return group
+}
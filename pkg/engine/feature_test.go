@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daemgo/gopkg/pkg/engine/flags"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeature(t *testing.T) {
+	p := flags.NewMemoryProvider(
+		flags.Flag{Name: "new-books", Enabled: true, Users: []string{"alice"}},
+		flags.Flag{Name: "book-covers", Enabled: true, Tenants: []string{"acme"}},
+	)
+
+	e := New()
+	e.Use(injectPrincipal(), Flags(p))
+
+	group := e.Group("/api/v1")
+	group.Feature("new-books").GET("/books", bookResourceType, func(c *gin.Context) {
+		c.String(http.StatusOK, "%t", FlagEnabled(c, "book-covers"))
+	})
+	assert.Equal(t, "new-books", e.routeMeta["GET /api/v1/books"].Feature)
+
+	do := func(p *Principal) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/books", nil)
+		if p != nil {
+			req = req.WithContext(WithPrincipal(req.Context(), p))
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "NOT_FOUND", decodeResponse(t, w).Error.Code)
+	assert.Equal(t, http.StatusNotFound, do(&Principal{Subject: "bob"}).Code)
+
+	w = do(&Principal{Subject: "alice"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "false", w.Body.String())
+
+	w = do(&Principal{Subject: "alice", Tenant: "acme"})
+	assert.Equal(t, "true", w.Body.String())
+
+	p.Set(flags.Flag{Name: "new-books", Enabled: true})
+	assert.Equal(t, http.StatusOK, do(nil).Code)
+}
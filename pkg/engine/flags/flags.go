@@ -0,0 +1,260 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/log"
+
+	"go.uber.org/zap"
+)
+
+// Flag is a feature flag and its targeting rules. An enabled flag without
+// rules is on for everyone, otherwise it's on for the listed users and
+// tenants and for Percentage percent of the others.
+type Flag struct {
+	// Name identifies the flag.
+	Name string `json:"name"`
+	// Enabled turns the flag off for everyone if false.
+	Enabled bool `json:"enabled"`
+	// Percentage is the share of the users, or the tenants for the
+	// anonymous requests, the flag is on for, from 0 to 100.
+	Percentage int `json:"percentage,omitempty"`
+	// Tenants are the tenants the flag is on for.
+	Tenants []string `json:"tenants,omitempty"`
+	// Users are the users the flag is on for.
+	Users []string `json:"users,omitempty"`
+}
+
+// Evaluate reports whether the flag is on for s.
+func (f Flag) Evaluate(s Subject) bool {
+	if !f.Enabled {
+		return false
+	}
+	if f.Percentage <= 0 && len(f.Tenants) == 0 && len(f.Users) == 0 {
+		return true
+	}
+	if s.User != "" && contains(f.Users, s.User) {
+		return true
+	}
+	if s.Tenant != "" && contains(f.Tenants, s.Tenant) {
+		return true
+	}
+
+	key := s.User
+	if key == "" {
+		key = s.Tenant
+	}
+	if key == "" || f.Percentage <= 0 {
+		return false
+	}
+	return bucket(f.Name, key) < uint32(f.Percentage)
+}
+
+// bucket spreads the keys over [0, 100), the same key always falls in the
+// same bucket of a flag.
+func bucket(name string, key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + "/" + key))
+	return h.Sum32() % 100
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FlagProvider provides the feature flags.
+type FlagProvider interface {
+	// Flag returns the flag name, the second return value reports whether
+	// it's defined.
+	Flag(name string) (Flag, bool)
+}
+
+// MemoryProvider keeps the flags in memory.
+type MemoryProvider struct {
+	mutex sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewMemoryProvider creates a MemoryProvider with flags.
+func NewMemoryProvider(flags ...Flag) *MemoryProvider {
+	p := &MemoryProvider{flags: make(map[string]Flag, len(flags))}
+	for _, f := range flags {
+		p.flags[f.Name] = f
+	}
+	return p
+}
+
+// Flag implements FlagProvider.
+func (p *MemoryProvider) Flag(name string) (Flag, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	f, ok := p.flags[name]
+	return f, ok
+}
+
+// Set adds or replaces f.
+func (p *MemoryProvider) Set(f Flag) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.flags[f.Name] = f
+}
+
+// Replace replaces all the flags.
+func (p *MemoryProvider) Replace(flags []Flag) {
+	m := make(map[string]Flag, len(flags))
+	for _, f := range flags {
+		m[f.Name] = f
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.flags = m
+}
+
+// FileProvider loads the flags from a JSON file holding a list of flags,
+// and reloads them once the file changes if it's watched.
+type FileProvider struct {
+	*MemoryProvider
+	path string
+
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewFileProvider loads the flags from path.
+func NewFileProvider(path string) (*FileProvider, error) {
+	p := &FileProvider{MemoryProvider: NewMemoryProvider(), path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload loads the flags from the file again, the flags are kept if the
+// file is invalid.
+func (p *FileProvider) Reload() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.reload()
+}
+
+func (p *FileProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	var flags []Flag
+	if err := json.Unmarshal(data, &flags); err != nil {
+		return err
+	}
+	p.Replace(flags)
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	return nil
+}
+
+// Watch checks the file every interval and reloads it once it changes,
+// until ctx is done. The failed reloads are logged and retried at the next
+// change.
+func (p *FileProvider) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.reloadIfChanged()
+		}
+	}
+}
+
+func (p *FileProvider) reloadIfChanged() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil || (info.ModTime().Equal(p.modTime) && info.Size() == p.size) {
+		return
+	}
+	if err := p.reload(); err != nil {
+		p.modTime = info.ModTime()
+		p.size = info.Size()
+		log.Warnw("reload feature flags failed", zap.String("path", p.path), zap.Error(err))
+	}
+}
+
+// Subject is who the flags are evaluated for.
+type Subject struct {
+	User   string
+	Tenant string
+}
+
+type providerKey struct{}
+
+type subjectKey struct{}
+
+var (
+	defaultMutex    sync.RWMutex
+	defaultProvider FlagProvider
+)
+
+// SetDefault sets the provider used when the context carries none.
+func SetDefault(p FlagProvider) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultProvider = p
+}
+
+// WithProvider returns a copy of ctx carrying p.
+func WithProvider(ctx context.Context, p FlagProvider) context.Context {
+	return context.WithValue(ctx, providerKey{}, p)
+}
+
+// WithSubject returns a copy of ctx carrying s.
+func WithSubject(ctx context.Context, s Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, s)
+}
+
+// SubjectFrom returns the subject carried by ctx.
+func SubjectFrom(ctx context.Context) Subject {
+	s, _ := ctx.Value(subjectKey{}).(Subject)
+	return s
+}
+
+// ProviderFrom returns the provider carried by ctx, or the default one.
+func ProviderFrom(ctx context.Context) FlagProvider {
+	if p, ok := ctx.Value(providerKey{}).(FlagProvider); ok {
+		return p
+	}
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultProvider
+}
+
+// Enabled reports whether the flag name is on for the subject of ctx, an
+// undefined flag is off. A *gin.Context doesn't carry the values of its
+// request context, pass ctx.Request.Context() or use engine.FlagEnabled.
+func Enabled(ctx context.Context, name string) bool {
+	p := ProviderFrom(ctx)
+	if p == nil {
+		return false
+	}
+	f, ok := p.Flag(name)
+	return ok && f.Evaluate(SubjectFrom(ctx))
+}
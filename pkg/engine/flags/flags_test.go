@@ -0,0 +1,86 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagEvaluate(t *testing.T) {
+	assert.False(t, Flag{Name: "f"}.Evaluate(Subject{User: "1"}))
+	assert.True(t, Flag{Name: "f", Enabled: true}.Evaluate(Subject{}))
+
+	targeted := Flag{Name: "f", Enabled: true, Users: []string{"alice"}, Tenants: []string{"acme"}}
+	assert.True(t, targeted.Evaluate(Subject{User: "alice"}))
+	assert.True(t, targeted.Evaluate(Subject{User: "bob", Tenant: "acme"}))
+	assert.False(t, targeted.Evaluate(Subject{User: "bob", Tenant: "globex"}))
+	assert.False(t, targeted.Evaluate(Subject{}))
+
+	half := Flag{Name: "f", Enabled: true, Percentage: 50}
+	on := 0
+	for i := 0; i < 1000; i++ {
+		s := Subject{User: fmt.Sprint(i)}
+		if half.Evaluate(s) {
+			on++
+		}
+		assert.Equal(t, half.Evaluate(s), half.Evaluate(s))
+	}
+	assert.InDelta(t, 500, on, 60)
+	assert.False(t, half.Evaluate(Subject{}))
+	assert.True(t, Flag{Name: "f", Enabled: true, Percentage: 100}.Evaluate(Subject{Tenant: "acme"}))
+}
+
+func TestEnabled(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, Enabled(ctx, "f"))
+
+	p := NewMemoryProvider(Flag{Name: "f", Enabled: true, Users: []string{"alice"}})
+	SetDefault(p)
+	defer SetDefault(nil)
+	assert.False(t, Enabled(ctx, "f"))
+	assert.True(t, Enabled(WithSubject(ctx, Subject{User: "alice"}), "f"))
+	assert.False(t, Enabled(WithSubject(ctx, Subject{User: "alice"}), "missing"))
+
+	ctx = WithProvider(ctx, NewMemoryProvider(Flag{Name: "g", Enabled: true}))
+	assert.True(t, Enabled(ctx, "g"))
+	assert.False(t, Enabled(ctx, "f"))
+
+	p.Set(Flag{Name: "f", Enabled: true})
+	assert.True(t, Enabled(context.Background(), "f"))
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`[{"name":"f","enabled":false}]`), 0o600))
+
+	p, err := NewFileProvider(path)
+	assert.Nil(t, err)
+	f, ok := p.Flag("f")
+	assert.True(t, ok)
+	assert.False(t, f.Enabled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Watch(ctx, 5*time.Millisecond)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`[{"name":"f","enabled":true},{"name":"g","enabled":true}]`), 0o600))
+	assert.Eventually(t, func() bool {
+		f, _ := p.Flag("f")
+		_, ok := p.Flag("g")
+		return f.Enabled && ok
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`not json`), 0o600))
+	time.Sleep(30 * time.Millisecond)
+	f, _ = p.Flag("f")
+	assert.True(t, f.Enabled)
+	assert.Error(t, p.Reload())
+
+	_, err = NewFileProvider(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// HealthStatusOK means the check passed.
+	HealthStatusOK = "ok"
+	// HealthStatusFailing means the check failed or timed out.
+	HealthStatusFailing = "failing"
+
+	defaultCheckTimeout = 3 * time.Second
+)
+
+var (
+	// HealthResourceType is bound to the health routes.
+	HealthResourceType = ResourceType{
+		Scope:    ResourceScope("system"),
+		Resource: "health",
+	}
+
+	errShuttingDown = errors.New("engine is shutting down")
+	errNotServing   = errors.New("engine is not serving yet")
+)
+
+// Checker checks whether a dependency of the service is healthy.
+type Checker interface {
+	// Name is the name of the check shown in the response.
+	Name() string
+	// Check returns a non-nil error if the dependency is unhealthy,
+	// it should give up once ctx is done.
+	Check(ctx context.Context) error
+}
+
+type checkerFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (c *checkerFunc) Name() string {
+	return c.name
+}
+
+func (c *checkerFunc) Check(ctx context.Context) error {
+	return c.check(ctx)
+}
+
+// NewChecker creates a Checker from a function.
+func NewChecker(name string, check func(ctx context.Context) error) Checker {
+	return &checkerFunc{name: name, check: check}
+}
+
+// DBChecker returns a Checker which pings the database behind db.
+func DBChecker(name string, db *gorm.DB) Checker {
+	return NewChecker(name, func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	})
+}
+
+// DiskSpaceChecker returns a Checker which fails if the free space of the
+// file system containing path is less than minFree bytes.
+func DiskSpaceChecker(name string, path string, minFree uint64) Checker {
+	return NewChecker(name, func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("free space %d bytes on %s is below %d bytes", free, path, minFree)
+		}
+		return nil
+	})
+}
+
+// CheckResult is the result of a single check.
+type CheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthReport is the aggregated result of a set of checks.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// fail adds a failed check which is not run by a Checker.
+func (r *HealthReport) fail(name string, err error) {
+	r.Status = HealthStatusFailing
+	r.Checks[name] = CheckResult{
+		Status:  HealthStatusFailing,
+		Latency: time.Duration(0).String(),
+		Error:   err.Error(),
+	}
+}
+
+// Health aggregates the liveness and readiness checks of a service.
+type Health struct {
+	timeout time.Duration
+
+	mutex     sync.RWMutex
+	liveness  []Checker
+	readiness []Checker
+}
+
+// NewHealth creates a Health whose checks time out after timeout,
+// which is 3s if it's not positive.
+func NewHealth(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	return &Health{timeout: timeout}
+}
+
+// AddLivenessCheck adds a check used by /livez and /healthz.
+func (h *Health) AddLivenessCheck(c Checker) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.liveness = append(h.liveness, c)
+}
+
+// AddReadinessCheck adds a check used by /readyz and /healthz.
+func (h *Health) AddReadinessCheck(c Checker) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.readiness = append(h.readiness, c)
+}
+
+// Run runs the checks concurrently and aggregates the results.
+func (h *Health) Run(ctx context.Context, checkers []Checker) HealthReport {
+	report := HealthReport{
+		Status: HealthStatusOK,
+		Checks: make(map[string]CheckResult, len(checkers)),
+	}
+
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for _, c := range checkers {
+		wg.Add(1)
+		go func(c Checker) {
+			defer wg.Done()
+			result := h.runOne(ctx, c)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[c.Name()] = result
+			if result.Status != HealthStatusOK {
+				report.Status = HealthStatusFailing
+			}
+		}(c)
+	}
+	wg.Wait()
+	return report
+}
+
+func (h *Health) runOne(ctx context.Context, c Checker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{
+		Status:  HealthStatusOK,
+		Latency: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = HealthStatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (h *Health) checkers(liveness, readiness bool) []Checker {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var checkers []Checker
+	if liveness {
+		checkers = append(checkers, h.liveness...)
+	}
+	if readiness {
+		checkers = append(checkers, h.readiness...)
+	}
+	return checkers
+}
+
+func (h *Health) handler(e *Engine, liveness, readiness bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		report := h.Run(ctx.Request.Context(), h.checkers(liveness, readiness))
+		if readiness {
+			switch {
+			case e.ShuttingDown():
+				report.fail("shutdown", errShuttingDown)
+			case !e.Ready():
+				report.fail("serving", errNotServing)
+			}
+		}
+
+		status := http.StatusOK
+		if report.Status != HealthStatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		ctx.JSON(status, report)
+	}
+}
+
+// MountHealth registers /healthz, /readyz and /livez under the group.
+// /readyz fails until Serve has started and during the graceful shutdown
+// window of the engine.
+func (rg RouterGroupWrapper) MountHealth(h *Health) {
+	rg.GET("/healthz", HealthResourceType, h.handler(rg.engine, true, true))
+	rg.GET("/readyz", HealthResourceType, h.handler(rg.engine, false, true))
+	rg.GET("/livez", HealthResourceType, h.handler(rg.engine, true, false))
+}
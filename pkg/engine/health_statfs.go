@@ -0,0 +1,13 @@
+//go:build linux || darwin
+
+package engine
+
+import "syscall"
+
+func diskFree(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/mock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doHealth(t *testing.T, e *Engine, path string) (int, HealthReport) {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report HealthReport
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func TestHealth(t *testing.T) {
+	db, _, err := mock.GetNewMySqlMock()
+	assert.Nil(t, err)
+
+	e := New()
+	h := NewHealth(50 * time.Millisecond)
+	h.AddLivenessCheck(DiskSpaceChecker("disk", ".", 1))
+	h.AddReadinessCheck(DBChecker("db", db))
+	h.AddReadinessCheck(NewChecker("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	e.Group("/").MountHealth(h)
+	e.lifecycle.ready.Store(true)
+
+	code, report := doHealth(t, e, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, HealthStatusOK, report.Status)
+	assert.Equal(t, HealthStatusOK, report.Checks["disk"].Status)
+
+	code, report = doHealth(t, e, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthStatusFailing, report.Status)
+	assert.Equal(t, HealthStatusOK, report.Checks["db"].Status)
+	assert.Equal(t, HealthStatusFailing, report.Checks["slow"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+	assert.NotContains(t, report.Checks, "disk")
+
+	code, report = doHealth(t, e, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Len(t, report.Checks, 3)
+
+	assert.Equal(t, HealthResourceType, e.Routers["GET /readyz"])
+}
+
+func TestReadinessDuringShutdown(t *testing.T) {
+	e := New()
+	h := NewHealth(0)
+	h.AddLivenessCheck(NewChecker("fail", func(ctx context.Context) error {
+		return errors.New("dead")
+	}))
+	e.Group("/").MountHealth(h)
+
+	code, report := doHealth(t, e, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, errNotServing.Error(), report.Checks["serving"].Error)
+
+	e.lifecycle.ready.Store(true)
+	code, _ = doHealth(t, e, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	e.lifecycle.ready.Store(false)
+	e.lifecycle.shuttingDown.Store(true)
+	code, report = doHealth(t, e, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, errShuttingDown.Error(), report.Checks["shutdown"].Error)
+
+	code, report = doHealth(t, e, "/livez")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "dead", report.Checks["fail"].Error)
+}
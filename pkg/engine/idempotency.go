@@ -0,0 +1,385 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotentReplayed  = "Idempotent-Replayed"
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyBody    = 1 << 20
+	maxIdempotencyKeyLength   = 255
+	idempotencyFingerprintSep = "\n"
+)
+
+var (
+	ErrIdempotencyKeyMissing  = response.NewError(http.StatusBadRequest, "IDEMPOTENCY_KEY_MISSING", "Idempotency-Key header is required")
+	ErrIdempotencyKeyInvalid  = response.NewError(http.StatusBadRequest, "IDEMPOTENCY_KEY_INVALID", "Idempotency-Key header is too long")
+	ErrIdempotencyKeyReused   = response.NewError(http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "Idempotency-Key was used with a different request")
+	ErrIdempotencyKeyInFlight = response.NewError(http.StatusConflict, "IDEMPOTENCY_KEY_IN_FLIGHT", "a request with the same Idempotency-Key is in progress")
+)
+
+// IdempotencyRecord is the state of an idempotency key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request which used the key first.
+	Fingerprint string
+	// Completed reports whether the response is stored.
+	Completed bool
+	// Status, Header and Body are the stored response.
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore keeps the idempotency records, implement it on a shared
+// backend to deduplicate across multiple instances.
+type IdempotencyStore interface {
+	// Get returns the record of key, the second return value reports
+	// whether it exists.
+	Get(ctx context.Context, key string) (*IdempotencyRecord, bool, error)
+	// Reserve creates an in-progress record for key if it doesn't exist,
+	// it reports whether the record was created.
+	Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (bool, error)
+	// Complete stores the response of key.
+	Complete(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Release deletes the record of key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+type idempotencyEntry struct {
+	record   IdempotencyRecord
+	expireAt time.Time
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore which keeps the records
+// in memory.
+type MemoryIdempotencyStore struct {
+	mutex     sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryIdempotencyStore creates a MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+// sweep deletes the expired records, the keys which are never used again
+// would be kept forever otherwise.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if now.After(entry.expireAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *MemoryIdempotencyStore) lookup(key string) (*idempotencyEntry, bool) {
+	entry, ok := s.entries[key]
+	if ok && s.now().After(entry.expireAt) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry, ok
+}
+
+// Get implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) (*IdempotencyRecord, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+	record := entry.record
+	return &record, true, nil
+}
+
+// Reserve implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key string, fingerprint string, ttl time.Duration) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	s.sweep(now)
+	if _, ok := s.lookup(key); ok {
+		return false, nil
+	}
+	s.entries[key] = &idempotencyEntry{
+		record:   IdempotencyRecord{Fingerprint: fingerprint},
+		expireAt: now.Add(ttl),
+	}
+	return true, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[key] = &idempotencyEntry{
+		record:   *record,
+		expireAt: s.now().Add(ttl),
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// keyedMutex serializes the requests sharing a key in-process.
+type keyedMutex struct {
+	mutex sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func (km *keyedMutex) lock(key string) func() {
+	km.mutex.Lock()
+	if km.locks == nil {
+		km.locks = make(map[string]*keyedLock)
+	}
+	l, ok := km.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		km.locks[key] = l
+	}
+	l.refs++
+	km.mutex.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		km.mutex.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mutex.Unlock()
+	}
+}
+
+// IdempotencyOptions configures the Idempotency middleware.
+type IdempotencyOptions struct {
+	// Store keeps the records, a MemoryIdempotencyStore by default.
+	Store IdempotencyStore
+	// TTL is how long the responses are replayed, 24h by default.
+	TTL time.Duration
+	// Header carries the key, "Idempotency-Key" by default.
+	Header string
+	// Required rejects the unsafe requests without a key.
+	Required bool
+	// MaxBodySize is the largest body read to fingerprint the requests
+	// carrying a key, larger ones are rejected, 1MiB by default.
+	MaxBodySize int64
+}
+
+// recordingWriter keeps a copy of the body written through it.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency returns a middleware which stores the first response of the
+// POST, PUT, PATCH and DELETE requests carrying an idempotency key and
+// replays it for the retries. Keys are scoped by the principal, concurrent
+// duplicates are serialized and a key reused with a different method, path
+// or body is rejected. Responses with a 5xx status are not stored.
+func (e *Engine) Idempotency(opts IdempotencyOptions) gin.HandlerFunc {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultIdempotencyTTL
+	}
+	if opts.Header == "" {
+		opts.Header = HeaderIdempotencyKey
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultIdempotencyBody
+	}
+	locks := &keyedMutex{}
+
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			ctx.Next()
+			return
+		}
+
+		idemKey := ctx.GetHeader(opts.Header)
+		if idemKey == "" {
+			if opts.Required {
+				Fail(ctx, ErrIdempotencyKeyMissing)
+				return
+			}
+			ctx.Next()
+			return
+		}
+		if len(idemKey) > maxIdempotencyKeyLength {
+			Fail(ctx, ErrIdempotencyKeyInvalid)
+			return
+		}
+
+		fingerprint, err := requestFingerprint(ctx.Request, opts.MaxBodySize)
+		if err != nil {
+			Fail(ctx, err)
+			return
+		}
+		key := ActorFromPrincipal(ctx) + "|" + idemKey
+
+		unlock := locks.lock(key)
+		defer unlock()
+
+		c := ctx.Request.Context()
+		record, ok, err := opts.Store.Get(c, key)
+		if err != nil {
+			e.idempotencyStoreFailed(ctx, err)
+			return
+		}
+		if ok {
+			switch {
+			case record.Fingerprint != fingerprint:
+				Fail(ctx, ErrIdempotencyKeyReused)
+			case !record.Completed:
+				Fail(ctx, ErrIdempotencyKeyInFlight)
+			default:
+				replayResponse(ctx, record)
+			}
+			return
+		}
+
+		reserved, err := opts.Store.Reserve(c, key, fingerprint, opts.TTL)
+		if err != nil {
+			e.idempotencyStoreFailed(ctx, err)
+			return
+		}
+		if !reserved {
+			Fail(ctx, ErrIdempotencyKeyInFlight)
+			return
+		}
+
+		before := ctx.Writer.Header().Clone()
+		w := &recordingWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = w
+		defer func() {
+			// a panicking handler must not hold the key until it expires
+			if r := recover(); r != nil {
+				ctx.Writer = w.ResponseWriter
+				if err := opts.Store.Release(c, key); err != nil {
+					e.logger.Errorw("failed to release idempotency key",
+						zap.String("request_id", RequestIDFrom(ctx)),
+						zap.Error(err),
+					)
+				}
+				panic(r)
+			}
+		}()
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+
+		if ctx.Writer.Status() >= http.StatusInternalServerError {
+			err = opts.Store.Release(c, key)
+		} else {
+			err = opts.Store.Complete(c, key, &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Completed:   true,
+				Status:      ctx.Writer.Status(),
+				Header:      headerSetSince(before, ctx.Writer.Header()),
+				Body:        w.body.Bytes(),
+			}, opts.TTL)
+		}
+		if err != nil {
+			e.logger.Errorw("failed to store idempotent response",
+				zap.String("request_id", RequestIDFrom(ctx)),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func (e *Engine) idempotencyStoreFailed(ctx *gin.Context, err error) {
+	e.logger.Errorw("idempotency store failed",
+		zap.String("request_id", RequestIDFrom(ctx)),
+		zap.Error(err),
+	)
+	Fail(ctx, response.ErrServiceUnavailable)
+}
+
+// requestFingerprint hashes the method, path, query and body of req, the
+// body is put back for the handlers. Bodies larger than max are rejected.
+func requestFingerprint(req *http.Request, max int64) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(req.Method + idempotencyFingerprintSep +
+		req.URL.Path + idempotencyFingerprintSep +
+		req.URL.Query().Encode() + idempotencyFingerprintSep))
+	if req.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(req.Body, max+1))
+		if err != nil {
+			return "", err
+		}
+		if int64(len(body)) > max {
+			return "", response.ErrPayloadTooLarge
+		}
+		req.Body = readCloser{
+			Reader: bytes.NewReader(body),
+			Closer: req.Body,
+		}
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func replayResponse(ctx *gin.Context, record *IdempotencyRecord) {
+	h := ctx.Writer.Header()
+	for k, v := range record.Header {
+		if strings.EqualFold(k, HeaderRequestID) {
+			continue
+		}
+		h[k] = v
+	}
+	h.Set(HeaderIdempotentReplayed, "true")
+	ctx.Writer.WriteHeader(record.Status)
+	_, _ = ctx.Writer.Write(record.Body)
+	ctx.Abort()
+}
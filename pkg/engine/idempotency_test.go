@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	e := New()
+	e.Use(e.Idempotency(IdempotencyOptions{}))
+
+	var created int32
+	group := e.Group("/api/v1")
+	group.POST("/users", userResourceType, func(c *gin.Context) {
+		n := atomic.AddInt32(&created, 1)
+		time.Sleep(20 * time.Millisecond)
+		c.Header("Location", "/api/v1/users/1")
+		c.JSON(http.StatusCreated, gin.H{"n": n})
+	})
+	group.DELETE("/users/:user_id", userResourceType, func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+	group.PUT("/users/:user_id", userResourceType, func(c *gin.Context) {
+		if c.Query("panic") == "true" {
+			panic("boom")
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(HeaderIdempotencyKey, key)
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = do(http.MethodPost, "/api/v1/users", "k1", `{"name":"alex"}`)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, created)
+	replayed := 0
+	for _, w := range results {
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.JSONEq(t, `{"n":1}`, w.Body.String())
+		assert.Equal(t, "/api/v1/users/1", w.Header().Get("Location"))
+		if w.Header().Get(HeaderIdempotentReplayed) == "true" {
+			replayed++
+		}
+	}
+	assert.Equal(t, 2, replayed)
+
+	w := do(http.MethodPost, "/api/v1/users", "k1", `{"name":"bob"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, ErrIdempotencyKeyReused.Code, decodeResponse(t, w).Error.Code)
+
+	do(http.MethodPost, "/api/v1/users", "", `{"name":"alex"}`)
+	do(http.MethodPost, "/api/v1/users", "k2", `{"name":"alex"}`)
+	assert.EqualValues(t, 3, created)
+
+	// server errors are not stored, so the retry runs again
+	assert.Equal(t, http.StatusInternalServerError, do(http.MethodDelete, "/api/v1/users/1", "k3", "").Code)
+	w = do(http.MethodDelete, "/api/v1/users/1", "k3", "")
+	assert.Empty(t, w.Header().Get(HeaderIdempotentReplayed))
+
+	// the query is part of the request
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPut, "/api/v1/users/1?notify=true", "k4", "").Code)
+	w = do(http.MethodPut, "/api/v1/users/1?notify=false", "k4", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// a panic releases the key, so the retry runs again
+	assert.Panics(t, func() {
+		do(http.MethodPut, "/api/v1/users/1?panic=true", "k5", "")
+	})
+	assert.Panics(t, func() {
+		do(http.MethodPut, "/api/v1/users/1?panic=true", "k5", "")
+	})
+
+	w = do(http.MethodPost, "/api/v1/users", "k6", strings.Repeat("a", defaultIdempotencyBody+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestIdempotencyHeaders(t *testing.T) {
+	e := New()
+	var requests int32
+	e.Use(func(c *gin.Context) {
+		c.Header("X-Request-Count", strconv.Itoa(int(atomic.AddInt32(&requests, 1))))
+	}, e.Idempotency(IdempotencyOptions{}))
+	e.Group("/api/v1").POST("/users", userResourceType, func(c *gin.Context) {
+		c.Header("Location", "/api/v1/users/1")
+		c.Status(http.StatusCreated)
+	})
+
+	do := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users", nil)
+		req.Header.Set(HeaderIdempotencyKey, "k1")
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, "1", do().Header().Get("X-Request-Count"))
+	w := do()
+	assert.Equal(t, "true", w.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, "/api/v1/users/1", w.Header().Get("Location"))
+	assert.Equal(t, "2", w.Header().Get("X-Request-Count"))
+}
+
+func TestIdempotencyRequired(t *testing.T) {
+	e := New()
+	e.Use(e.Idempotency(IdempotencyOptions{Required: true}))
+	e.Group("/").POST("/users", userResourceType, func(c *gin.Context) {})
+	e.Group("/").GET("/users", userResourceType, func(c *gin.Context) {})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrIdempotencyKeyMissing.Code, decodeResponse(t, w).Error.Code)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMemoryIdempotencyStoreTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	s := NewMemoryIdempotencyStore()
+	s.now = clock.Now
+
+	ok, err := s.Reserve(context.Background(), "k", "f", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, _ = s.Reserve(context.Background(), "k", "f", time.Minute)
+	assert.False(t, ok)
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	_, ok, _ = s.Get(context.Background(), "k")
+	assert.False(t, ok)
+
+	// expired keys which are never looked up again are swept
+	_, _ = s.Reserve(context.Background(), "unused", "f", time.Minute)
+	clock.now = clock.now.Add(2 * time.Minute)
+	_, _ = s.Reserve(context.Background(), "other", "f", time.Minute)
+	assert.NotContains(t, s.entries, "unused")
+}
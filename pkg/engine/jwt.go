@@ -0,0 +1,373 @@
+package engine
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+
+	defaultRolesClaim  = "roles"
+	defaultTenantClaim = "tenant"
+)
+
+var (
+	ErrTokenMalformed = errors.New("token is malformed")
+	ErrTokenSignature = errors.New("token signature is invalid")
+	ErrTokenExpired   = errors.New("token is expired")
+	ErrTokenNoExpiry  = errors.New("token has no expiration")
+	ErrTokenNotYet    = errors.New("token is not valid yet")
+	ErrTokenIssuer    = errors.New("token issuer is invalid")
+	ErrTokenAudience  = errors.New("token audience is invalid")
+	ErrUnknownKey     = errors.New("no key found to verify the token")
+)
+
+type verifyKey struct {
+	alg string
+	key interface{}
+}
+
+// KeySet holds the keys used to verify the JWT signatures by key ID.
+type KeySet struct {
+	mutex sync.RWMutex
+	keys  map[string]verifyKey
+}
+
+// NewKeySet creates an empty KeySet.
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]verifyKey)}
+}
+
+// AddHMAC adds a HS256 secret.
+func (ks *KeySet) AddHMAC(kid string, secret []byte) {
+	ks.add(kid, AlgHS256, secret)
+}
+
+// AddRSA adds a RS256 public key.
+func (ks *KeySet) AddRSA(kid string, key *rsa.PublicKey) {
+	ks.add(kid, AlgRS256, key)
+}
+
+// AddECDSA adds an ES256 public key, the curve must be P-256.
+func (ks *KeySet) AddECDSA(kid string, key *ecdsa.PublicKey) {
+	ks.add(kid, AlgES256, key)
+}
+
+func (ks *KeySet) add(kid string, alg string, key interface{}) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	ks.keys[kid] = verifyKey{alg: alg, key: key}
+}
+
+// candidates returns the keys which may verify a token signed with alg,
+// the key ID narrows them down to a single key if it's present.
+func (ks *KeySet) candidates(kid string, alg string) []verifyKey {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	if kid != "" {
+		k, ok := ks.keys[kid]
+		if !ok || k.alg != alg {
+			return nil
+		}
+		return []verifyKey{k}
+	}
+
+	var keys []verifyKey
+	for _, k := range ks.keys {
+		if k.alg == alg {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// symmetric
+	K string `json:"k"`
+}
+
+// LoadJWKS loads a KeySet from a local JWKS file.
+func LoadJWKS(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a KeySet from a JWKS document, keys which are not used
+// for signatures are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	ks := NewKeySet()
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if err := ks.addJWK(k); err != nil {
+			return nil, fmt.Errorf("bad jwk %q: %w", k.Kid, err)
+		}
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) addJWK(k jwk) error {
+	switch k.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return err
+		}
+		ks.AddHMAC(k.Kid, secret)
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return err
+		}
+		ks.AddRSA(k.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())})
+	case "EC":
+		if k.Crv != "P-256" {
+			return fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return err
+		}
+		ks.AddECDSA(k.Kid, &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+	default:
+		return fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+	return nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	p, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(p), nil
+}
+
+// JWTOptions configures a JWTVerifier.
+type JWTOptions struct {
+	// Keys verify the signatures.
+	Keys *KeySet
+	// Issuer is the expected "iss" claim, not checked if it's empty.
+	Issuer string
+	// Audience is the expected "aud" claim, not checked if it's empty.
+	Audience string
+	// Leeway is the clock skew tolerated on "exp" and "nbf".
+	Leeway time.Duration
+	// AllowMissingExp accepts tokens without an "exp" claim, which are
+	// rejected by default.
+	AllowMissingExp bool
+	// RolesClaim is the claim holding the roles, "roles" by default.
+	RolesClaim string
+	// TenantClaim is the claim holding the tenant, "tenant" by default.
+	TenantClaim string
+}
+
+// JWTVerifier verifies JWTs and turns them into a Principal.
+type JWTVerifier struct {
+	opts JWTOptions
+	now  func() time.Time
+}
+
+// NewJWTVerifier creates a JWTVerifier.
+func NewJWTVerifier(opts JWTOptions) *JWTVerifier {
+	if opts.Keys == nil {
+		opts.Keys = NewKeySet()
+	}
+	if opts.RolesClaim == "" {
+		opts.RolesClaim = defaultRolesClaim
+	}
+	if opts.TenantClaim == "" {
+		opts.TenantClaim = defaultTenantClaim
+	}
+	return &JWTVerifier{opts: opts, now: time.Now}
+}
+
+// Verify checks the signature and the registered claims of token.
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	keys := v.opts.Keys.candidates(header.Kid, header.Alg)
+	if len(keys) == 0 {
+		return nil, ErrUnknownKey
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range keys {
+		if verifySignature(k, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrTokenSignature
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	tenant, _ := claims[v.opts.TenantClaim].(string)
+	return &Principal{
+		Subject: subject,
+		Roles:   stringsClaim(claims[v.opts.RolesClaim]),
+		Tenant:  tenant,
+		Method:  AuthMethodJWT,
+		Claims:  claims,
+	}, nil
+}
+
+func (v *JWTVerifier) validateClaims(claims map[string]interface{}) error {
+	now := v.now()
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.After(time.Unix(int64(exp), 0).Add(v.opts.Leeway)) {
+			return ErrTokenExpired
+		}
+	} else if !v.opts.AllowMissingExp {
+		return ErrTokenNoExpiry
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Before(time.Unix(int64(nbf), 0).Add(-v.opts.Leeway)) {
+			return ErrTokenNotYet
+		}
+	}
+	if v.opts.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.opts.Issuer {
+			return ErrTokenIssuer
+		}
+	}
+	if v.opts.Audience != "" {
+		found := false
+		for _, aud := range audienceClaim(claims["aud"]) {
+			if aud == v.opts.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrTokenAudience
+		}
+	}
+	return nil
+}
+
+func verifySignature(k verifyKey, signed []byte, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+	switch key := k.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(key, digest[:], r, s)
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	p, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// stringsClaim reads a claim which is either a string array or a space
+// separated string, like "scope".
+func stringsClaim(v interface{}) []string {
+	if s, ok := v.(string); ok {
+		return strings.Fields(s)
+	}
+	return audienceClaim(v)
+}
+
+// audienceClaim reads the "aud" claim, which is either a string array or
+// a single string.
+func audienceClaim(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		list := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
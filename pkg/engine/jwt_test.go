@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testHMACSecret = []byte("secret")
+)
+
+func signTestJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	assert.Nil(t, err)
+	payload, err := json.Marshal(claims)
+	assert.Nil(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		assert.Nil(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		assert.Nil(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func b64BigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	jwks := fmt.Sprintf(`{"keys":[
+		{"kty":"RSA","kid":"rsa","use":"sig","n":%q,"e":%q},
+		{"kty":"EC","kid":"ec","crv":"P-256","x":%q,"y":%q},
+		{"kty":"oct","kid":"hmac","k":%q},
+		{"kty":"RSA","kid":"enc","use":"enc","n":"","e":""}
+	]}`, b64BigInt(rsaKey.N), b64BigInt(big.NewInt(int64(rsaKey.E))),
+		b64BigInt(ecKey.X), b64BigInt(ecKey.Y), base64.RawURLEncoding.EncodeToString(testHMACSecret))
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.Nil(t, os.WriteFile(path, []byte(jwks), 0644))
+
+	keys, err := LoadJWKS(path)
+	assert.Nil(t, err)
+
+	v := NewJWTVerifier(JWTOptions{Keys: keys, Issuer: "https://issuer", Audience: "api"})
+	now := time.Unix(1700000000, 0)
+	v.now = func() time.Time { return now }
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":    "alex",
+			"iss":    "https://issuer",
+			"aud":    []string{"api", "web"},
+			"exp":    now.Add(time.Minute).Unix(),
+			"roles":  []string{"admin"},
+			"tenant": "acme",
+		}
+		for k, val := range overrides {
+			c[k] = val
+		}
+		return c
+	}
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      interface{}
+	}{
+		{AlgRS256, "rsa", rsaKey},
+		{AlgES256, "ec", ecKey},
+		{AlgHS256, "hmac", testHMACSecret},
+		{AlgES256, "", ecKey},
+	} {
+		p, err := v.Verify(signTestJWT(t, tc.alg, tc.kid, tc.key, claims(nil)))
+		assert.Nil(t, err, tc.alg)
+		assert.Equal(t, "alex", p.Subject)
+		assert.Equal(t, []string{"admin"}, p.Roles)
+		assert.Equal(t, "acme", p.Tenant)
+		assert.Equal(t, AuthMethodJWT, p.Method)
+	}
+
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "rsa", testHMACSecret, claims(nil)))
+	assert.Equal(t, ErrUnknownKey, err, "alg must match the key")
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", []byte("bad"), claims(nil)))
+	assert.Equal(t, ErrTokenSignature, err)
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", testHMACSecret, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})))
+	assert.Equal(t, ErrTokenExpired, err)
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", testHMACSecret, claims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()})))
+	assert.Equal(t, ErrTokenNotYet, err)
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", testHMACSecret, claims(map[string]interface{}{"iss": "evil"})))
+	assert.Equal(t, ErrTokenIssuer, err)
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", testHMACSecret, claims(map[string]interface{}{"aud": "web"})))
+	assert.Equal(t, ErrTokenAudience, err)
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", testHMACSecret, claims(map[string]interface{}{"aud": "web api"})))
+	assert.Equal(t, ErrTokenAudience, err, "a string aud is a single value")
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", testHMACSecret, claims(map[string]interface{}{"aud": "api"})))
+	assert.Nil(t, err)
+
+	noExp := claims(nil)
+	delete(noExp, "exp")
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", testHMACSecret, noExp))
+	assert.Equal(t, ErrTokenNoExpiry, err)
+	v.opts.AllowMissingExp = true
+	_, err = v.Verify(signTestJWT(t, AlgHS256, "hmac", testHMACSecret, noExp))
+	assert.Nil(t, err)
+
+	_, err = v.Verify("not-a-token")
+	assert.Equal(t, ErrTokenMalformed, err)
+}
@@ -0,0 +1,274 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// unmatchedRoute labels the requests which match no route, so the raw
+	// URLs never end up in the labels.
+	unmatchedRoute = "<unmatched>"
+
+	// otherMethod labels the requests with a non-standard method, so
+	// clients cannot grow the series with made up methods.
+	otherMethod = "OTHER"
+)
+
+var (
+	// DefaultLatencyBuckets are the upper bounds in seconds of the latency
+	// histogram buckets.
+	DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	standardMethods = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodPost:    true,
+		http.MethodPut:     true,
+		http.MethodPatch:   true,
+		http.MethodDelete:  true,
+		http.MethodConnect: true,
+		http.MethodOptions: true,
+		http.MethodTrace:   true,
+	}
+
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	// MetricsResourceType is bound to the metrics route.
+	MetricsResourceType = ResourceType{
+		Scope:    ResourceScope("system"),
+		Resource: "metrics",
+	}
+)
+
+// routeLabels identifies a series, the fields are bounded by the
+// registered routes.
+type routeLabels struct {
+	method   string
+	route    string
+	scope    string
+	resource string
+}
+
+type requestLabels struct {
+	routeLabels
+	status string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Metrics collects the request count, latency and in-flight requests of
+// an engine, and exposes them in the Prometheus text format.
+type Metrics struct {
+	namespace string
+	buckets   []float64
+
+	mutex     sync.Mutex
+	requests  map[requestLabels]uint64
+	latencies map[requestLabels]*histogram
+	inFlight  map[routeLabels]*int64
+}
+
+// NewMetrics creates a Metrics whose metric names are prefixed with
+// namespace, buckets defaults to DefaultLatencyBuckets.
+func NewMetrics(namespace string, buckets []float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Metrics{
+		namespace: namespace,
+		buckets:   buckets,
+		requests:  make(map[requestLabels]uint64),
+		latencies: make(map[requestLabels]*histogram),
+		inFlight:  make(map[routeLabels]*int64),
+	}
+}
+
+// StatusClass maps a status code to its class, e.g. 404 to "4xx".
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// methodLabel returns method if it's a standard method, otherwise "OTHER".
+func methodLabel(method string) string {
+	if standardMethods[method] {
+		return method
+	}
+	return otherMethod
+}
+
+func (m *Metrics) gauge(labels routeLabels) *int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	g, ok := m.inFlight[labels]
+	if !ok {
+		g = new(int64)
+		m.inFlight[labels] = g
+	}
+	return g
+}
+
+func (m *Metrics) observe(labels requestLabels, latency time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.requests[labels]++
+	h, ok := m.latencies[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latencies[labels] = h
+	}
+	seconds := latency.Seconds()
+	for i, le := range m.buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Middleware returns a middleware which records every request of e, it's
+// labeled by the route template instead of the raw URL.
+func (m *Metrics) Middleware(e *Engine) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		typ, _ := e.ResourceTypeOf(ctx)
+		labels := routeLabels{
+			method:   methodLabel(ctx.Request.Method),
+			route:    route,
+			scope:    string(typ.Scope),
+			resource: typ.Resource,
+		}
+
+		g := m.gauge(labels)
+		atomic.AddInt64(g, 1)
+		defer atomic.AddInt64(g, -1)
+
+		start := time.Now()
+		ctx.Next()
+
+		m.observe(requestLabels{
+			routeLabels: labels,
+			status:      StatusClass(ctx.Writer.Status()),
+		}, time.Since(start))
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var b strings.Builder
+	requests := m.name("http_requests_total")
+	fmt.Fprintf(&b, "# HELP %s Total number of HTTP requests.\n# TYPE %s counter\n", requests, requests)
+	for _, labels := range sortedRequestLabels(m.requests) {
+		fmt.Fprintf(&b, "%s{%s} %d\n", requests, labels.String(), m.requests[labels])
+	}
+
+	latency := m.name("http_request_duration_seconds")
+	fmt.Fprintf(&b, "# HELP %s HTTP request latency in seconds.\n# TYPE %s histogram\n", latency, latency)
+	for _, labels := range sortedRequestLabels(m.latencies) {
+		h := m.latencies[labels]
+		for i, le := range m.buckets {
+			fmt.Fprintf(&b, "%s_bucket{%s,%s} %d\n", latency, labels.String(), label("le", formatFloat(le)), h.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", latency, labels.String(), h.count)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", latency, labels.String(), formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", latency, labels.String(), h.count)
+	}
+
+	inFlight := m.name("http_requests_in_flight")
+	fmt.Fprintf(&b, "# HELP %s Number of HTTP requests being served.\n# TYPE %s gauge\n", inFlight, inFlight)
+	routes := make([]routeLabels, 0, len(m.inFlight))
+	for labels := range m.inFlight {
+		routes = append(routes, labels)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].String() < routes[j].String()
+	})
+	for _, labels := range routes {
+		fmt.Fprintf(&b, "%s{%s} %d\n", inFlight, labels.String(), atomic.LoadInt64(m.inFlight[labels]))
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Handler returns a handler which exposes the metrics.
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+		ctx.Header("Content-Type", metricsContentType)
+		_, _ = m.WriteTo(ctx.Writer)
+	}
+}
+
+// MountMetrics registers /metrics under the group.
+func (rg RouterGroupWrapper) MountMetrics(m *Metrics) {
+	rg.GET("/metrics", MetricsResourceType, m.Handler())
+}
+
+func (m *Metrics) name(name string) string {
+	if m.namespace == "" {
+		return name
+	}
+	return m.namespace + "_" + name
+}
+
+func (l routeLabels) String() string {
+	return strings.Join([]string{
+		label("method", l.method),
+		label("route", l.route),
+		label("scope", l.scope),
+		label("resource", l.resource),
+	}, ",")
+}
+
+func (l requestLabels) String() string {
+	return l.routeLabels.String() + "," + label("status", l.status)
+}
+
+func sortedRequestLabels[V any](m map[requestLabels]V) []requestLabels {
+	list := make([]requestLabels, 0, len(m))
+	for labels := range m {
+		list = append(list, labels)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].String() < list[j].String()
+	})
+	return list
+}
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
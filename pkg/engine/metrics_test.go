@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	e := New()
+	m := NewMetrics("app", []float64{1, 0.1})
+	e.Use(m.Middleware(e))
+
+	group := e.Group("/api/v1")
+	group.GET("/users/:user_id", userResourceType, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	group.DELETE("/users/:user_id", userResourceType, func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	e.Group("/").MountMetrics(m)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/api/v1/users/2", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/v1/users/3", nil),
+		httptest.NewRequest(http.MethodGet, "/unknown/1", nil),
+		httptest.NewRequest("PURGE", "/unknown/2", nil),
+	} {
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, metricsContentType, w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	userLabels := `method="GET",route="/api/v1/users/:user_id",scope="management",resource="user"`
+	assert.Contains(t, body, "# TYPE app_http_requests_total counter\n")
+	assert.Contains(t, body, `app_http_requests_total{`+userLabels+`,status="2xx"} 2`)
+	assert.Contains(t, body, `app_http_requests_total{method="DELETE",route="/api/v1/users/:user_id",scope="management",resource="user",status="4xx"} 1`)
+	assert.Contains(t, body, `app_http_requests_total{method="GET",route="<unmatched>",scope="",resource="",status="4xx"} 1`)
+	assert.Contains(t, body, `app_http_requests_total{method="OTHER",route="<unmatched>",scope="",resource="",status="4xx"} 1`)
+	assert.NotContains(t, body, "PURGE")
+	assert.Contains(t, body, `app_http_request_duration_seconds_bucket{`+userLabels+`,status="2xx",le="0.1"} 2`)
+	assert.Contains(t, body, `app_http_request_duration_seconds_bucket{`+userLabels+`,status="2xx",le="+Inf"} 2`)
+	assert.Contains(t, body, `app_http_request_duration_seconds_count{`+userLabels+`,status="2xx"} 2`)
+	assert.Contains(t, body, `app_http_requests_in_flight{`+userLabels+`} 0`)
+	assert.Contains(t, body, `app_http_requests_in_flight{method="GET",route="/metrics",scope="system",resource="metrics"} 1`)
+	assert.False(t, strings.Contains(body, "/api/v1/users/1"), "raw URLs must not be labels")
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", StatusClass(204))
+	assert.Equal(t, "5xx", StatusClass(503))
+	assert.Equal(t, "unknown", StatusClass(0))
+}
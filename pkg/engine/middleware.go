@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+	"github.com/daemgo/gopkg/pkg/id"
+	"github.com/daemgo/gopkg/pkg/log"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderRequestID is the header used to propagate the request ID.
+	HeaderRequestID = "X-Request-ID"
+
+	requestIDContextKey = "engine/request-id"
+)
+
+// RequestIDFrom returns the request ID stored in the context by the
+// RequestID middleware.
+func RequestIDFrom(ctx *gin.Context) string {
+	return ctx.GetString(requestIDContextKey)
+}
+
+// RequestID returns a middleware which reuses the request ID sent by the
+// client or generates a new one, and echos it in the response header.
+func RequestID(gen id.IDGenerator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(HeaderRequestID)
+		if requestID == "" {
+			requestID = gen.NextID().String()
+		}
+		ctx.Set(requestIDContextKey, requestID)
+		ctx.Header(HeaderRequestID, requestID)
+		ctx.Next()
+	}
+}
+
+// setRequestID sets the request ID header like RequestID does, for the
+// responses written before the middlewares run.
+func (e *Engine) setRequestID(w http.ResponseWriter, req *http.Request) {
+	requestID := req.Header.Get(HeaderRequestID)
+	if requestID == "" && e.idGenerator != nil {
+		requestID = e.idGenerator.NextID().String()
+	}
+	if requestID != "" {
+		w.Header().Set(HeaderRequestID, requestID)
+	}
+}
+
+// AccessLog returns a middleware which logs every request with its
+// method, path, status, latency and the resource bound to the route.
+func (e *Engine) AccessLog() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		typ, _ := e.ResourceTypeOf(ctx)
+		fields := []zap.Field{
+			zap.String("request_id", RequestIDFrom(ctx)),
+			zap.String("method", ctx.Request.Method),
+			zap.String("path", ctx.Request.URL.Path),
+			zap.String("route", ctx.FullPath()),
+			zap.Int("status", ctx.Writer.Status()),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", ctx.ClientIP()),
+			zap.String("scope", string(typ.Scope)),
+			zap.String("resource", typ.Resource),
+		}
+		if sc, ok := SpanContextFrom(ctx); ok {
+			fields = append(fields, traceFields(sc)...)
+		}
+		if len(ctx.Errors) > 0 {
+			fields = append(fields, zap.String("errors", ctx.Errors.String()))
+		}
+		e.logger.Infow("access", fields...)
+	}
+}
+
+// Recovery returns a middleware which recovers from any panics, logs the
+// stack and responds with ErrInternal in the error envelope.
+func Recovery(logger *log.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Errorw("panic recovered",
+					zap.String("request_id", RequestIDFrom(ctx)),
+					zap.String("method", ctx.Request.Method),
+					zap.String("path", ctx.Request.URL.Path),
+					zap.Any("panic", r),
+					zap.ByteString("stack", debug.Stack()),
+				)
+				Fail(ctx, response.ErrInternal)
+			}
+		}()
+		ctx.Next()
+	}
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daemgo/gopkg/pkg/id"
+	"github.com/daemgo/gopkg/pkg/log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWriteSyncer struct {
+	buf bytes.Buffer
+}
+
+func (fws *fakeWriteSyncer) Sync() error {
+	return nil
+}
+
+func (fws *fakeWriteSyncer) Write(p []byte) (int, error) {
+	return fws.buf.Write(p)
+}
+
+type fakeIDGenerator struct {
+	next id.ID
+}
+
+func (g *fakeIDGenerator) NextID() id.ID {
+	g.next++
+	return g.next
+}
+
+func newTestLogger(t *testing.T) (*log.Logger, *fakeWriteSyncer) {
+	fws := &fakeWriteSyncer{}
+	logger, err := log.NewLogger(log.WithLogLevel("info"), log.WithWriteSyncer(fws))
+	assert.Nil(t, err, "failed to new logger: ", err)
+	return logger, fws
+}
+
+func TestDefaultMiddlewares(t *testing.T) {
+	logger, fws := newTestLogger(t)
+	e := Default(WithLogger(logger), WithIDGenerator(&fakeIDGenerator{}))
+
+	group := e.Group("/api/v1")
+	group.GET("/users/:user_id", userResourceType, func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("user_id"))
+	})
+	group.POST("/books", bookResourceType, func(c *gin.Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(HeaderRequestID))
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(fws.buf.Bytes(), &entry))
+	assert.Equal(t, "access", entry["message"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/api/v1/users/:user_id", entry["route"])
+	assert.Equal(t, "management", entry["scope"])
+	assert.Equal(t, "user", entry["resource"])
+	assert.EqualValues(t, http.StatusOK, entry["status"])
+	fws.buf.Reset()
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/books", nil)
+	req.Header.Set(HeaderRequestID, "from-client")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "from-client", w.Header().Get(HeaderRequestID))
+	assert.Contains(t, w.Body.String(), "from-client")
+	assert.Contains(t, fws.buf.String(), "panic recovered")
+}
+
+func TestNewWithoutMiddlewares(t *testing.T) {
+	e := New()
+	assert.Len(t, e.Handlers, 0)
+	assert.Equal(t, log.DefaultLogger, e.Logger())
+}
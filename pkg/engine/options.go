@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"github.com/daemgo/gopkg/pkg/id"
+	"github.com/daemgo/gopkg/pkg/log"
+)
+
+// Option configures how to set up engine.
+type Option interface {
+	apply(*options)
+}
+
+type funcOption struct {
+	do func(*options)
+}
+
+func (fo *funcOption) apply(o *options) {
+	fo.do(o)
+}
+
+type options struct {
+	logger             *log.Logger
+	idGenerator        id.IDGenerator
+	defaultMiddlewares bool
+	strictRoutes       bool
+	trustedProxies     []string
+}
+
+// WithLogger sets the logger used by the engine middlewares,
+// log.DefaultLogger is used if it's not set.
+func WithLogger(logger *log.Logger) Option {
+	return &funcOption{
+		do: func(o *options) {
+			o.logger = logger
+		},
+	}
+}
+
+// WithIDGenerator sets the generator used to create request IDs.
+func WithIDGenerator(gen id.IDGenerator) Option {
+	return &funcOption{
+		do: func(o *options) {
+			o.idGenerator = gen
+		},
+	}
+}
+
+// WithDefaultMiddlewares installs the default middleware stack, which
+// contains panic recovery, request ID propagation and access logs.
+func WithDefaultMiddlewares() Option {
+	return &funcOption{
+		do: func(o *options) {
+			o.defaultMiddlewares = true
+		},
+	}
+}
+
+// WithStrictRoutes makes the registration of a route fail fast if it
+// conflicts with a registered one as reported by Engine.Validate, the
+// route methods panic and Register returns the conflicts.
+func WithStrictRoutes() Option {
+	return &funcOption{
+		do: func(o *options) {
+			o.strictRoutes = true
+		},
+	}
+}
+
+// WithTrustedProxies sets the networks, as IPs or CIDRs, of the proxies
+// whose X-Forwarded-For and X-Real-IP headers are trusted to find the
+// client IP. No proxy is trusted by default, so the client IP is the
+// remote address of the connection.
+func WithTrustedProxies(proxies ...string) Option {
+	return &funcOption{
+		do: func(o *options) {
+			o.trustedProxies = proxies
+		},
+	}
+}
@@ -0,0 +1,267 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const defaultRetryBackoff = 50 * time.Millisecond
+
+// proxyMethods are the methods a proxied prefix is registered for.
+var proxyMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// ProxyOption configures a proxied prefix.
+type ProxyOption interface {
+	apply(*proxyOptions)
+}
+
+type funcProxyOption struct {
+	do func(*proxyOptions)
+}
+
+func (fo *funcProxyOption) apply(o *proxyOptions) {
+	fo.do(o)
+}
+
+type proxyOptions struct {
+	rewrite             func(string) string
+	setHeaders          map[string]string
+	stripHeaders        []string
+	stripResponseHeader []string
+	timeout             time.Duration
+	retries             int
+	retryBackoff        time.Duration
+	transport           http.RoundTripper
+}
+
+// WithRewrite rewrites the path forwarded to the target, it receives the
+// path with the prefix stripped, which is what is forwarded by default.
+func WithRewrite(rewrite func(path string) string) ProxyOption {
+	return &funcProxyOption{
+		do: func(o *proxyOptions) {
+			o.rewrite = rewrite
+		},
+	}
+}
+
+// WithProxyHeaders sets headers on the forwarded requests.
+func WithProxyHeaders(headers map[string]string) ProxyOption {
+	return &funcProxyOption{
+		do: func(o *proxyOptions) {
+			o.setHeaders = headers
+		},
+	}
+}
+
+// WithStripHeaders removes headers from the forwarded requests, e.g. the
+// credentials meant for the engine only.
+func WithStripHeaders(names ...string) ProxyOption {
+	return &funcProxyOption{
+		do: func(o *proxyOptions) {
+			o.stripHeaders = append(o.stripHeaders, names...)
+		},
+	}
+}
+
+// WithStripResponseHeaders removes headers from the responses of the target.
+func WithStripResponseHeaders(names ...string) ProxyOption {
+	return &funcProxyOption{
+		do: func(o *proxyOptions) {
+			o.stripResponseHeader = append(o.stripResponseHeader, names...)
+		},
+	}
+}
+
+// WithProxyTimeout bounds every forwarded request, the client gets 504
+// once it elapses.
+func WithProxyTimeout(d time.Duration) ProxyOption {
+	return &funcProxyOption{
+		do: func(o *proxyOptions) {
+			o.timeout = d
+		},
+	}
+}
+
+// WithRetries retries the idempotent requests without a body up to n
+// times if the target can't be reached or answers 502, 503 or 504.
+func WithRetries(n int, backoff time.Duration) ProxyOption {
+	return &funcProxyOption{
+		do: func(o *proxyOptions) {
+			o.retries = n
+			o.retryBackoff = backoff
+		},
+	}
+}
+
+// WithTransport sets the transport used to reach the target,
+// http.DefaultTransport is used if it's not set.
+func WithTransport(transport http.RoundTripper) ProxyOption {
+	return &funcProxyOption{
+		do: func(o *proxyOptions) {
+			o.transport = transport
+		},
+	}
+}
+
+// Proxy forwards every request under prefix to target. The routes are
+// registered with typ like the native ones, so that they go through the
+// same authorization, audit and metrics middlewares. It panics if target
+// is not an absolute URL.
+func (rg RouterGroupWrapper) Proxy(prefix string, target string, typ ResourceType, opts ...ProxyOption) gin.IRoutes {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		panic(fmt.Sprintf("engine: invalid proxy target %q", target))
+	}
+
+	o := &proxyOptions{transport: http.DefaultTransport, retryBackoff: defaultRetryBackoff}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+
+	base := path.Join(rg.BasePath(), prefix)
+	e := rg.engine
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			rest := "/" + strings.TrimLeft(strings.TrimPrefix(r.In.URL.Path, base), "/")
+			if o.rewrite != nil {
+				rest = o.rewrite(rest)
+			}
+			r.SetURL(u)
+			r.Out.URL.Path = strings.TrimRight(u.Path, "/") + rest
+			r.Out.URL.RawPath = ""
+			r.SetXForwarded()
+			InjectTrace(r.In.Context(), r.Out.Header)
+			for _, name := range o.stripHeaders {
+				r.Out.Header.Del(name)
+			}
+			for name, value := range o.setHeaders {
+				r.Out.Header.Set(name, value)
+			}
+		},
+		Transport: &retryTransport{
+			next:    o.transport,
+			retries: o.retries,
+			backoff: o.retryBackoff,
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			for _, name := range o.stripResponseHeader {
+				resp.Header.Del(name)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			apiErr := response.ErrBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				apiErr = response.ErrGatewayTimeout
+			}
+			e.logger.Warnw("proxy failed",
+				zap.String("request_id", w.Header().Get(HeaderRequestID)),
+				zap.String("method", req.Method),
+				zap.String("path", req.URL.Path),
+				zap.String("target", u.Host),
+				zap.Error(err))
+			writeAPIError(w, apiErr)
+		},
+	}
+
+	handler := func(ctx *gin.Context) {
+		req := ctx.Request
+		if o.timeout > 0 {
+			c, cancel := context.WithTimeout(req.Context(), o.timeout)
+			defer cancel()
+			req = req.WithContext(c)
+		}
+		proxy.ServeHTTP(proxyWriter{ctx.Writer}, req)
+	}
+
+	var routes gin.IRoutes
+	for _, method := range proxyMethods {
+		rg.handle(method, prefix, typ, []gin.HandlerFunc{handler})
+		routes = rg.handle(method, path.Join(prefix, "*proxy_path"), typ, []gin.HandlerFunc{handler})
+	}
+	return routes
+}
+
+// proxyWriter hides the CloseNotify of gin, which panics if the underlying
+// writer doesn't implement it, ReverseProxy relies on the request context.
+type proxyWriter struct {
+	w gin.ResponseWriter
+}
+
+func (w proxyWriter) Header() http.Header {
+	return w.w.Header()
+}
+
+func (w proxyWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func (w proxyWriter) WriteHeader(status int) {
+	w.w.WriteHeader(status)
+}
+
+func (w proxyWriter) Flush() {
+	w.w.Flush()
+}
+
+// retryTransport retries the idempotent requests without a body.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retryable := t.retries > 0 && (req.Body == nil || req.Body == http.NoBody) && isIdempotent(req.Method)
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if !retryable || attempt >= t.retries || !shouldRetry(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(t.backoff * time.Duration(attempt+1))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy(t *testing.T) {
+	var flaky int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/legacy/flaky":
+			if atomic.AddInt32(&flaky, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/legacy/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Backend", "legacy")
+		w.Header().Set("X-Internal", "secret")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("X-Source")+" "+
+			r.Header.Get("X-API-Key")+" "+string(body))
+	}))
+	defer backend.Close()
+
+	sink := &memoryAuditSink{}
+	m := NewMetrics("app", nil)
+	e := New()
+	e.Use(m.Middleware(e), Authenticate(AuthOptions{
+		APIKeys: map[string]Principal{"key-1": {Subject: "admin"}},
+	}), e.Audit(AuditOptions{Sink: sink, Methods: []string{http.MethodPost}}))
+
+	group := e.Group("/api/v1")
+	group.Proxy("/books", backend.URL+"/legacy", bookResourceType,
+		WithProxyHeaders(map[string]string{"X-Source": "engine"}),
+		WithStripHeaders(HeaderAPIKey),
+		WithStripResponseHeaders("X-Internal"),
+		WithRewrite(func(p string) string { return strings.Replace(p, "/v1/", "/", 1) }),
+		WithProxyTimeout(100*time.Millisecond),
+		WithRetries(2, time.Millisecond),
+	)
+	assert.Equal(t, bookResourceType, e.Routers["POST /api/v1/books/*proxy_path"])
+	assert.Equal(t, bookResourceType, e.Routers["GET /api/v1/books"])
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(HeaderAPIKey, "key-1")
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/books/v1/1?q=go", "hello")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "POST /legacy/1?q=go engine  hello", w.Body.String())
+	assert.Equal(t, "legacy", w.Header().Get("X-Backend"))
+	assert.Empty(t, w.Header().Get("X-Internal"))
+
+	w = do(http.MethodGet, "/api/v1/books", "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "GET /legacy/ engine  ", w.Body.String())
+
+	w = do(http.MethodGet, "/api/v1/books/flaky", "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 3, flaky)
+
+	w = do(http.MethodGet, "/api/v1/books/slow", "")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "GATEWAY_TIMEOUT", decodeResponse(t, w).Error.Code)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/books/1", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Len(t, sink.events, 1)
+	assert.Equal(t, "admin", sink.events[0].Actor)
+	assert.Equal(t, "book", sink.events[0].Resource)
+	assert.Equal(t, "/api/v1/books/*proxy_path", sink.events[0].Route)
+
+	w = httptest.NewRecorder()
+	m.WriteTo(w)
+	assert.Contains(t, w.Body.String(), `method="POST",route="/api/v1/books/*proxy_path",scope="store",resource="book",status="2xx"} 1`)
+}
+
+func TestProxyBadGateway(t *testing.T) {
+	logger, _ := newTestLogger(t)
+	e := New(WithLogger(logger))
+	e.Group("/").Proxy("/legacy", "http://127.0.0.1:1", bookResourceType)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/legacy/1", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "BAD_GATEWAY", decodeResponse(t, w).Error.Code)
+
+	assert.Panics(t, func() {
+		e.Group("/").Proxy("/bad", "legacy:8080", bookResourceType)
+	})
+}
@@ -0,0 +1,324 @@
+package engine
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+	"github.com/daemgo/gopkg/pkg/id"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	defaultIDColumn = "id"
+)
+
+// ErrInvalidCursor is returned by DecodeCursor for a malformed cursor.
+var ErrInvalidCursor = errors.New("engine: invalid cursor")
+
+// EncodeCursor encodes the ID of the last item of a page into an opaque
+// cursor.
+func EncodeCursor(v id.ID) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// DecodeCursor decodes a cursor made by EncodeCursor.
+func DecodeCursor(cursor string) (id.ID, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) != 8 {
+		return 0, ErrInvalidCursor
+	}
+	return id.ID(binary.BigEndian.Uint64(b)), nil
+}
+
+// SortField is a field of the sort parameter.
+type SortField struct {
+	Field  string
+	Column string
+	Desc   bool
+}
+
+// Filter is a filter[field] parameter, a filter with several values
+// matches any of them.
+type Filter struct {
+	Field  string
+	Column string
+	Values []string
+}
+
+// QueryOptions whitelists the fields a list route can be sorted and
+// filtered by.
+type QueryOptions struct {
+	// SortFields are the fields allowed in the sort parameter.
+	SortFields []string
+	// FilterFields are the fields allowed in the filter parameters.
+	FilterFields []string
+	// Columns maps the fields to their columns, a field is its own column
+	// if absent.
+	Columns map[string]string
+	// DefaultSort is used if the request has no sort parameter, e.g.
+	// "-created_at".
+	DefaultSort string
+	// DefaultSize is the page size if the request has none, 20 by default.
+	DefaultSize int
+	// MaxSize is the maximum page size, 100 by default.
+	MaxSize int
+	// IDColumn is the column the cursors are made of, "id" by default.
+	IDColumn string
+}
+
+// QuerySpec is the parsed pagination, sorting and filtering of a list
+// request. It's paginated by cursor if the request has a cursor
+// parameter, by offset otherwise. The cursors are made of the ID column,
+// so a page by cursor is always ordered by it and has no Sort.
+type QuerySpec struct {
+	Page    int
+	Size    int
+	Cursor  *id.ID
+	Sort    []SortField
+	Filters []Filter
+
+	idColumn string
+}
+
+// IsCursor reports whether the request is paginated by cursor.
+func (q QuerySpec) IsCursor() bool {
+	return q.Cursor != nil
+}
+
+// Offset returns the number of items before the page.
+func (q QuerySpec) Offset() int {
+	return (q.Page - 1) * q.Size
+}
+
+// ParseQuery parses the page, size, cursor, sort and filter[field]
+// parameters of the request, the fields which are not whitelisted by opts
+// are rejected with a validation error.
+func ParseQuery(ctx *gin.Context, opts QueryOptions) (QuerySpec, error) {
+	if opts.DefaultSize <= 0 {
+		opts.DefaultSize = defaultPageSize
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = maxPageSize
+	}
+	if opts.IDColumn == "" {
+		opts.IDColumn = defaultIDColumn
+	}
+
+	query := ctx.Request.URL.Query()
+	spec := QuerySpec{Page: 1, Size: opts.DefaultSize, idColumn: opts.IDColumn}
+	var details []response.FieldError
+
+	if v := query.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			details = append(details, queryFieldError("page", "min", "page must be a positive integer"))
+		}
+		spec.Page = page
+	}
+	if v := query.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		switch {
+		case err != nil || size < 1:
+			details = append(details, queryFieldError("size", "min", "size must be a positive integer"))
+		case size > opts.MaxSize:
+			details = append(details, queryFieldError("size", "max", fmt.Sprintf("size must be at most %d", opts.MaxSize)))
+		}
+		spec.Size = size
+	}
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := DecodeCursor(v)
+		if err != nil {
+			details = append(details, queryFieldError("cursor", "cursor", "cursor is invalid"))
+		}
+		spec.Cursor = &cursor
+	}
+
+	sortParam := query.Get("sort")
+	if sortParam == "" {
+		sortParam = opts.DefaultSort
+	}
+	var sorts []SortField
+	for _, field := range strings.Split(sortParam, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimLeft(field, "+-")
+		name, ok := whitelisted(opts.SortFields, field)
+		if !ok {
+			details = append(details, queryFieldError("sort", "oneof", fmt.Sprintf("sort by '%s' is not allowed", field)))
+			continue
+		}
+		sorts = append(sorts, SortField{Field: name, Column: opts.column(name), Desc: desc})
+	}
+	if !spec.IsCursor() {
+		spec.Sort = sorts
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		field := key[len("filter[") : len(key)-1]
+		name, ok := whitelisted(opts.FilterFields, field)
+		if !ok {
+			details = append(details, queryFieldError(key, "oneof", fmt.Sprintf("filter by '%s' is not allowed", field)))
+			continue
+		}
+		spec.Filters = append(spec.Filters, Filter{Field: name, Column: opts.column(name), Values: query[key]})
+	}
+
+	if len(details) > 0 {
+		return QuerySpec{}, response.ErrValidation.WithDetails(details)
+	}
+	return spec, nil
+}
+
+// whitelisted returns the entry of fields matching field case
+// insensitively, the client's casing never reaches the columns.
+func whitelisted(fields []string, field string) (string, bool) {
+	for _, f := range fields {
+		if strings.EqualFold(f, field) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+func (opts QueryOptions) column(field string) string {
+	if c, ok := opts.Columns[field]; ok {
+		return c
+	}
+	return field
+}
+
+func queryFieldError(field string, rule string, message string) response.FieldError {
+	return response.FieldError{Field: field, Rule: rule, Message: message}
+}
+
+// ApplyFilters is a gorm scope applying the filters only, e.g. to count
+// the items.
+func (q QuerySpec) ApplyFilters(db *gorm.DB) *gorm.DB {
+	for _, f := range q.Filters {
+		column := clause.Column{Name: f.Column}
+		if len(f.Values) == 1 {
+			db = db.Where(clause.Eq{Column: column, Value: f.Values[0]})
+			continue
+		}
+		values := make([]interface{}, len(f.Values))
+		for i, v := range f.Values {
+			values[i] = v
+		}
+		db = db.Where(clause.IN{Column: column, Values: values})
+	}
+	return db
+}
+
+// Apply is a gorm scope applying the filters, the sort and the page. A
+// page by cursor ignores the sort, it's ordered by the ID column the
+// cursors are made of and fetches one more item, which tells NewCursorPage
+// there is a next page.
+func (q QuerySpec) Apply(db *gorm.DB) *gorm.DB {
+	db = q.ApplyFilters(db)
+	if !q.IsCursor() {
+		for _, s := range q.Sort {
+			db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Column}, Desc: s.Desc})
+		}
+		return db.Offset(q.Offset()).Limit(q.Size)
+	}
+
+	column := clause.Column{Name: q.idColumn}
+	if *q.Cursor > 0 {
+		db = db.Where(clause.Gt{Column: column, Value: uint64(*q.Cursor)})
+	}
+	return db.Order(clause.OrderByColumn{Column: column}).Limit(q.Size + 1)
+}
+
+// PageLinks are the links to the neighbour pages.
+type PageLinks struct {
+	Self  string `json:"self"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// Page is the paginated envelope of the list routes.
+type Page[T any] struct {
+	Items      []T       `json:"items"`
+	Page       int       `json:"page,omitempty"`
+	Size       int       `json:"size"`
+	Total      *int64    `json:"total,omitempty"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Links      PageLinks `json:"links"`
+}
+
+// NewOffsetPage builds the page of items out of total items.
+func NewOffsetPage[T any](ctx *gin.Context, q QuerySpec, items []T, total int64) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	last := int((total + int64(q.Size) - 1) / int64(q.Size))
+	if last < 1 {
+		last = 1
+	}
+
+	p := Page[T]{Items: items, Page: q.Page, Size: q.Size, Total: &total}
+	p.Links.Self = pageLink(ctx.Request.URL, "page", strconv.Itoa(q.Page))
+	p.Links.First = pageLink(ctx.Request.URL, "page", "1")
+	p.Links.Last = pageLink(ctx.Request.URL, "page", strconv.Itoa(last))
+	if q.Page > 1 {
+		p.Links.Prev = pageLink(ctx.Request.URL, "page", strconv.Itoa(min(q.Page-1, last)))
+	}
+	if q.Page < last {
+		p.Links.Next = pageLink(ctx.Request.URL, "page", strconv.Itoa(q.Page+1))
+	}
+	return p
+}
+
+// NewCursorPage builds a page out of the items fetched with Apply, idOf
+// returns the ID the cursor of an item is made of.
+func NewCursorPage[T any](ctx *gin.Context, q QuerySpec, items []T, idOf func(T) id.ID) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	p := Page[T]{Size: q.Size}
+	p.Links.Self = ctx.Request.URL.RequestURI()
+	p.Links.First = pageLink(ctx.Request.URL, "cursor", EncodeCursor(0))
+	if len(items) > q.Size {
+		items = items[:q.Size]
+		p.NextCursor = EncodeCursor(idOf(items[len(items)-1]))
+		p.Links.Next = pageLink(ctx.Request.URL, "cursor", p.NextCursor)
+	}
+	p.Items = items
+	return p
+}
+
+// pageLink returns u with the parameter key set to value.
+func pageLink(u *url.URL, key string, value string) string {
+	query := u.Query()
+	query.Set(key, value)
+	link := *u
+	link.RawQuery = query.Encode()
+	return link.RequestURI()
+}
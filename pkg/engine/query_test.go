@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+	"github.com/daemgo/gopkg/pkg/id"
+	"github.com/daemgo/gopkg/pkg/mock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var testQueryOptions = QueryOptions{
+	SortFields:   []string{"name", "created_at"},
+	FilterFields: []string{"name", "status"},
+	Columns:      map[string]string{"status": "state"},
+	DefaultSort:  "-created_at",
+	MaxSize:      50,
+}
+
+func newQueryContext(target string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	return ctx
+}
+
+func TestCursor(t *testing.T) {
+	cursor := EncodeCursor(id.ID(42))
+	v, err := DecodeCursor(cursor)
+	assert.Nil(t, err)
+	assert.Equal(t, id.ID(42), v)
+
+	_, err = DecodeCursor("!!")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = DecodeCursor("AAAA")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestParseQuery(t *testing.T) {
+	spec, err := ParseQuery(newQueryContext("/users?page=2&size=10&sort=name,-created_at&filter[name]=foo&filter[status]=a&filter[status]=b"), testQueryOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, spec.Page)
+	assert.Equal(t, 10, spec.Size)
+	assert.Equal(t, 10, spec.Offset())
+	assert.False(t, spec.IsCursor())
+	assert.Equal(t, []SortField{
+		{Field: "name", Column: "name"},
+		{Field: "created_at", Column: "created_at", Desc: true},
+	}, spec.Sort)
+	assert.Equal(t, []Filter{
+		{Field: "name", Column: "name", Values: []string{"foo"}},
+		{Field: "status", Column: "state", Values: []string{"a", "b"}},
+	}, spec.Filters)
+
+	spec, err = ParseQuery(newQueryContext("/users?cursor="+EncodeCursor(7)), testQueryOptions)
+	assert.Nil(t, err)
+	assert.True(t, spec.IsCursor())
+	assert.Equal(t, id.ID(7), *spec.Cursor)
+	assert.Equal(t, 1, spec.Page)
+	assert.Equal(t, defaultPageSize, spec.Size)
+	assert.Empty(t, spec.Sort, "cursors are ordered by the ID column")
+
+	spec, err = ParseQuery(newQueryContext("/users?sort=-CREATED_AT&filter[STATUS]=a"), testQueryOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, []SortField{{Field: "created_at", Column: "created_at", Desc: true}}, spec.Sort)
+	assert.Equal(t, []Filter{{Field: "status", Column: "state", Values: []string{"a"}}}, spec.Filters)
+
+	_, err = ParseQuery(newQueryContext("/users?page=0&size=51&sort=password&filter[role]=admin&cursor=x"), testQueryOptions)
+	apiErr, ok := err.(*response.APIError)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, response.ErrValidation)
+	details := apiErr.Details.([]response.FieldError)
+	fields := make([]string, 0, len(details))
+	for _, d := range details {
+		fields = append(fields, d.Field)
+	}
+	assert.Equal(t, []string{"page", "size", "cursor", "sort", "filter[role]"}, fields)
+}
+
+func TestQuerySpecApply(t *testing.T) {
+	db, _, err := mock.GetNewMySqlMock()
+	assert.Nil(t, err)
+	db = db.Session(&gorm.Session{DryRun: true})
+
+	type User struct {
+		ID   uint64
+		Name string
+	}
+
+	spec, err := ParseQuery(newQueryContext("/users?page=3&size=10&sort=name&filter[status]=a&filter[status]=b"), testQueryOptions)
+	assert.Nil(t, err)
+	stmt := db.Scopes(spec.Apply).Find(&[]User{}).Statement
+	assert.Equal(t, "SELECT * FROM `users` WHERE `state` IN (?,?) ORDER BY `name` LIMIT 10 OFFSET 20", stmt.SQL.String())
+	assert.Equal(t, []interface{}{"a", "b"}, stmt.Vars)
+
+	stmt = db.Model(&User{}).Scopes(spec.ApplyFilters).Count(new(int64)).Statement
+	assert.Equal(t, "SELECT count(*) FROM `users` WHERE `state` IN (?,?)", stmt.SQL.String())
+
+	spec, err = ParseQuery(newQueryContext("/users?size=5&cursor="+EncodeCursor(9)+"&sort=-name&filter[name]=foo"), testQueryOptions)
+	assert.Nil(t, err)
+	stmt = db.Scopes(spec.Apply).Find(&[]User{}).Statement
+	assert.Equal(t, "SELECT * FROM `users` WHERE `name` = ? AND `id` > ? ORDER BY `id` LIMIT 6", stmt.SQL.String())
+	assert.Equal(t, []interface{}{"foo", uint64(9)}, stmt.Vars)
+}
+
+func TestNewOffsetPage(t *testing.T) {
+	ctx := newQueryContext("/users?page=2&size=10&filter[name]=foo")
+	spec, err := ParseQuery(ctx, testQueryOptions)
+	assert.Nil(t, err)
+
+	p := NewOffsetPage(ctx, spec, []string{"a"}, 25)
+	assert.Equal(t, []string{"a"}, p.Items)
+	assert.EqualValues(t, 25, *p.Total)
+	assert.Equal(t, PageLinks{
+		Self:  "/users?filter%5Bname%5D=foo&page=2&size=10",
+		First: "/users?filter%5Bname%5D=foo&page=1&size=10",
+		Prev:  "/users?filter%5Bname%5D=foo&page=1&size=10",
+		Next:  "/users?filter%5Bname%5D=foo&page=3&size=10",
+		Last:  "/users?filter%5Bname%5D=foo&page=3&size=10",
+	}, p.Links)
+
+	p = NewOffsetPage[string](newQueryContext("/users"), QuerySpec{Page: 1, Size: 20}, nil, 0)
+	assert.Equal(t, []string{}, p.Items)
+	assert.Equal(t, "", p.Links.Prev)
+	assert.Equal(t, "", p.Links.Next)
+	assert.Equal(t, "/users?page=1", p.Links.Last)
+}
+
+func TestNewCursorPage(t *testing.T) {
+	ctx := newQueryContext("/users?size=2")
+	spec, err := ParseQuery(ctx, QueryOptions{})
+	assert.Nil(t, err)
+	spec.Cursor = new(id.ID)
+
+	idOf := func(v int) id.ID { return id.ID(v) }
+	p := NewCursorPage(ctx, spec, []int{1, 2, 3}, idOf)
+	assert.Equal(t, []int{1, 2}, p.Items)
+	assert.Equal(t, EncodeCursor(2), p.NextCursor)
+	assert.Equal(t, "/users?cursor="+EncodeCursor(2)+"&size=2", p.Links.Next)
+
+	p = NewCursorPage(ctx, spec, []int{3}, idOf)
+	assert.Equal(t, []int{3}, p.Items)
+	assert.Equal(t, "", p.NextCursor)
+	assert.Equal(t, "", p.Links.Next)
+}
@@ -0,0 +1,350 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+
+	memoryStoreSweepInterval = time.Minute
+)
+
+// Algorithm is the algorithm used to enforce a Limit.
+type Algorithm string
+
+const (
+	// TokenBucket refills tokens at a constant rate and allows bursts up
+	// to the bucket capacity.
+	TokenBucket Algorithm = "token_bucket"
+	// SlidingWindow counts the requests in a window sliding over time,
+	// weighting the previous fixed window by its overlap.
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// Limit describes how many requests are allowed in a period.
+type Limit struct {
+	// Requests is the number of requests allowed in Period.
+	Requests int
+	// Period is the length of the window.
+	Period time.Duration
+	// Burst is the capacity of the token bucket, Requests by default.
+	Burst int
+	// Algorithm is TokenBucket by default.
+	Algorithm Algorithm
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// ttl is how long the state of a key matters after its last request: the
+// time to refill an empty bucket, or the current and previous windows.
+func (l Limit) ttl() time.Duration {
+	if l.Algorithm == SlidingWindow {
+		return 2 * l.Period
+	}
+	return time.Duration(float64(l.Period) * float64(l.burst()) / float64(l.Requests))
+}
+
+// RateLimitResult is the outcome of consuming a request from a limit.
+type RateLimitResult struct {
+	// Allowed reports whether the request is allowed.
+	Allowed bool
+	// Limit is the maximum number of requests.
+	Limit int
+	// Remaining is the number of requests left.
+	Remaining int
+	// Reset is the duration until the limit is fully restored.
+	Reset time.Duration
+	// RetryAfter is the duration to wait before retrying a denied request.
+	RetryAfter time.Duration
+}
+
+// Store keeps the rate limit state, implement it on a shared backend to
+// limit across multiple instances.
+type Store interface {
+	// Allow consumes one request of key under limit.
+	Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error)
+}
+
+type bucketState struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	// sliding window
+	windowStart time.Time
+	current     int
+	previous    int
+
+	expireAt time.Time
+}
+
+// MemoryStore is a Store which keeps the state in memory.
+type MemoryStore struct {
+	mutex     sync.Mutex
+	states    map[string]*bucketState
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore creates a MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[string]*bucketState),
+		now:    time.Now,
+	}
+}
+
+// Allow implements Store.
+func (s *MemoryStore) Allow(_ context.Context, key string, limit Limit) (RateLimitResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	state, ok := s.states[key]
+	if !ok {
+		state = &bucketState{
+			tokens:      float64(limit.burst()),
+			last:        now,
+			windowStart: now,
+		}
+		s.states[key] = state
+	}
+
+	var result RateLimitResult
+	if limit.Algorithm == SlidingWindow {
+		result = state.slidingWindow(now, limit)
+	} else {
+		result = state.tokenBucket(now, limit)
+	}
+	state.expireAt = now.Add(limit.ttl())
+	return result, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, state := range s.states {
+		if now.After(state.expireAt) {
+			delete(s.states, key)
+		}
+	}
+}
+
+func (b *bucketState) tokenBucket(now time.Time, limit Limit) RateLimitResult {
+	capacity := float64(limit.burst())
+	rate := float64(limit.Requests) / limit.Period.Seconds()
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	result := RateLimitResult{Limit: limit.burst()}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((capacity - b.tokens) / rate)
+	return result
+}
+
+func (b *bucketState) slidingWindow(now time.Time, limit Limit) RateLimitResult {
+	elapsed := now.Sub(b.windowStart)
+	if elapsed >= limit.Period {
+		windows := int(elapsed / limit.Period)
+		if windows == 1 {
+			b.previous = b.current
+		} else {
+			b.previous = 0
+		}
+		b.current = 0
+		b.windowStart = b.windowStart.Add(time.Duration(windows) * limit.Period)
+		elapsed = now.Sub(b.windowStart)
+	}
+
+	weight := 1 - float64(elapsed)/float64(limit.Period)
+	estimated := float64(b.previous)*weight + float64(b.current)
+
+	result := RateLimitResult{
+		Limit: limit.Requests,
+		Reset: limit.Period - elapsed,
+	}
+	if estimated+1 <= float64(limit.Requests) {
+		b.current++
+		estimated++
+		result.Allowed = true
+	} else if b.current+1 > limit.Requests || b.previous == 0 {
+		result.RetryAfter = limit.Period - elapsed
+	} else {
+		// wait until the previous window overlaps little enough
+		// to leave room for one more request
+		need := 1 - (float64(limit.Requests-b.current-1) / float64(b.previous))
+		result.RetryAfter = time.Duration(need*float64(limit.Period)) - elapsed
+	}
+	result.Remaining = int(math.Max(0, math.Floor(float64(limit.Requests)-estimated)))
+	return result
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// KeyFunc extracts the client key used to limit the request.
+type KeyFunc func(ctx *gin.Context) string
+
+// KeyByIP limits by the client IP, which is the remote address unless the
+// request comes from a proxy trusted with WithTrustedProxies.
+func KeyByIP(ctx *gin.Context) string {
+	return ctx.ClientIP()
+}
+
+// KeyByHeader limits by the value of a header, e.g. an API key, and falls
+// back to the client IP if the header is missing.
+func KeyByHeader(name string) KeyFunc {
+	return func(ctx *gin.Context) string {
+		if v := ctx.GetHeader(name); v != "" {
+			return name + ":" + v
+		}
+		return KeyByIP(ctx)
+	}
+}
+
+// RateLimitRule applies a limit to the routes bound to a resource, or to
+// a single route.
+type RateLimitRule struct {
+	// Resource is the resource the rule applies to, the zero value
+	// matches every resource and an empty Resource matches the whole Scope.
+	Resource ResourceType
+	// Route is the route template the rule applies to, e.g.
+	// /api/v1/users/:user_id, empty matches every route.
+	Route string
+	// Methods are the methods the rule applies to, empty matches every method.
+	Methods []string
+	// Limit is the limit enforced by the rule.
+	Limit Limit
+}
+
+func (r *RateLimitRule) match(method, route string, typ ResourceType) bool {
+	if r.Route != "" && r.Route != route {
+		return false
+	}
+	if r.Resource.Scope != "" && r.Resource.Scope != typ.Scope {
+		return false
+	}
+	if r.Resource.Resource != "" && r.Resource.Resource != typ.Resource {
+		return false
+	}
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitOptions configures the RateLimit middleware.
+type RateLimitOptions struct {
+	// Rules are matched in order, the first matching rule wins.
+	Rules []RateLimitRule
+	// KeyFunc extracts the client key, KeyByIP by default.
+	KeyFunc KeyFunc
+	// Store keeps the state, a MemoryStore by default.
+	Store Store
+}
+
+// RateLimit returns a middleware which limits the requests by the
+// ResourceType or the template of the matched route and a client key. It panics if a
+// rule has a non-positive Requests or Period.
+func (e *Engine) RateLimit(opts RateLimitOptions) gin.HandlerFunc {
+	for _, rule := range opts.Rules {
+		if rule.Limit.Requests <= 0 || rule.Limit.Period <= 0 {
+			panic(fmt.Sprintf("invalid rate limit %+v for %+v", rule.Limit, rule.Resource))
+		}
+	}
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = KeyByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+
+	return func(ctx *gin.Context) {
+		typ, _ := e.ResourceTypeOf(ctx)
+		method := ctx.Request.Method
+		route := ctx.FullPath()
+
+		var (
+			rule  *RateLimitRule
+			index int
+		)
+		for i := range opts.Rules {
+			if opts.Rules[i].match(method, route, typ) {
+				rule, index = &opts.Rules[i], i
+				break
+			}
+		}
+		if rule == nil {
+			ctx.Next()
+			return
+		}
+
+		key := strings.Join([]string{
+			strconv.Itoa(index),
+			string(typ.Scope),
+			typ.Resource,
+			opts.KeyFunc(ctx),
+		}, "|")
+		result, err := opts.Store.Allow(ctx.Request.Context(), key, rule.Limit)
+		if err != nil {
+			// fail open, the store being down should not take the service down
+			e.logger.Errorw("rate limit store failed",
+				zap.String("request_id", RequestIDFrom(ctx)),
+				zap.Error(err),
+			)
+			ctx.Next()
+			return
+		}
+
+		ctx.Header(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+		ctx.Header(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+		ctx.Header(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			ctx.Header(HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			Fail(ctx, response.ErrTooManyRequests)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestMemoryStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	return store, clock
+}
+
+func TestTokenBucket(t *testing.T) {
+	store, clock := newTestMemoryStore()
+	limit := Limit{Requests: 2, Period: time.Second, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		r, err := store.Allow(ctx, "k", limit)
+		assert.Nil(t, err)
+		assert.True(t, r.Allowed)
+		assert.Equal(t, 2-i, r.Remaining)
+	}
+
+	r, _ := store.Allow(ctx, "k", limit)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 500*time.Millisecond, r.RetryAfter)
+
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	r, _ = store.Allow(ctx, "k", limit)
+	assert.True(t, r.Allowed)
+
+	r, _ = store.Allow(ctx, "other", limit)
+	assert.True(t, r.Allowed)
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store, clock := newTestMemoryStore()
+	limit := Limit{Requests: 1, Period: time.Second, Burst: 120}
+	ctx := context.Background()
+
+	_, _ = store.Allow(ctx, "k", limit)
+	assert.Equal(t, clock.now.Add(120*time.Second), store.states["k"].expireAt)
+
+	// the bucket still lacks tokens after 2 periods, so it must be kept
+	clock.now = clock.now.Add(time.Minute)
+	_, _ = store.Allow(ctx, "other", limit)
+	assert.Contains(t, store.states, "k")
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	_, _ = store.Allow(ctx, "other", limit)
+	assert.NotContains(t, store.states, "k")
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store, clock := newTestMemoryStore()
+	limit := Limit{Requests: 4, Period: time.Second, Algorithm: SlidingWindow}
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		r, _ := store.Allow(ctx, "k", limit)
+		assert.True(t, r.Allowed)
+	}
+	r, _ := store.Allow(ctx, "k", limit)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, time.Second, r.RetryAfter)
+
+	// previous window still weights 3/4 of its 4 requests
+	clock.now = clock.now.Add(1250 * time.Millisecond)
+	r, _ = store.Allow(ctx, "k", limit)
+	assert.True(t, r.Allowed)
+	r, _ = store.Allow(ctx, "k", limit)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 250*time.Millisecond, r.RetryAfter)
+
+	clock.now = clock.now.Add(250 * time.Millisecond)
+	r, _ = store.Allow(ctx, "k", limit)
+	assert.True(t, r.Allowed)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	e := New()
+	e.Use(e.RateLimit(RateLimitOptions{
+		Rules: []RateLimitRule{
+			{
+				Resource: userResourceType,
+				Methods:  []string{http.MethodPut},
+				Limit:    Limit{Requests: 1, Period: time.Minute},
+			},
+			{
+				Route: "/api/v1/books/:book_id",
+				Limit: Limit{Requests: 1, Period: time.Minute},
+			},
+			{
+				Resource: ResourceType{Scope: "store"},
+				Limit:    Limit{Requests: 100, Period: time.Minute},
+			},
+		},
+		KeyFunc: KeyByHeader("X-API-Key"),
+	}))
+
+	group := e.Group("/api/v1")
+	group.PUT("/users/:user_id", userResourceType, func(c *gin.Context) {})
+	group.GET("/users/:user_id", userResourceType, func(c *gin.Context) {})
+	group.GET("/books", bookResourceType, func(c *gin.Context) {})
+	group.GET("/books/:book_id", bookResourceType, func(c *gin.Context) {})
+
+	do := func(method, path, apiKey string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", apiKey)
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPut, "/api/v1/users/1", "a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "0", w.Header().Get(HeaderRateLimitRemaining))
+
+	w = do(http.MethodPut, "/api/v1/users/2", "a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get(HeaderRetryAfter))
+	assert.Equal(t, "TOO_MANY_REQUESTS", decodeResponse(t, w).Error.Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/v1/users/1", "b").Code)
+
+	w = do(http.MethodGet, "/api/v1/users/1", "a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(HeaderRateLimitLimit))
+
+	w = do(http.MethodGet, "/api/v1/books", "a")
+	assert.Equal(t, "100", w.Header().Get(HeaderRateLimitLimit))
+
+	w = do(http.MethodGet, "/api/v1/books/1", "a")
+	assert.Equal(t, "1", w.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/api/v1/books/2", "a").Code)
+}
+
+func TestKeyByIPTrustedProxies(t *testing.T) {
+	do := func(e *Engine) []int {
+		e.Use(e.RateLimit(RateLimitOptions{
+			Rules: []RateLimitRule{{Limit: Limit{Requests: 1, Period: time.Hour}}},
+		}))
+		e.Group("/").GET("/", userResourceType, func(c *gin.Context) {})
+
+		var codes []int
+		for _, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", ip)
+			e.ServeHTTP(w, req)
+			codes = append(codes, w.Code)
+		}
+		return codes
+	}
+
+	// a rotating X-Forwarded-For doesn't escape the limit
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests}, do(New()))
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK}, do(New(WithTrustedProxies("10.0.0.0/8"))))
+}
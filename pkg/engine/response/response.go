@@ -0,0 +1,123 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Response is the envelope of every JSON response written by the engine.
+type Response struct {
+	// Success reports whether the request succeeded.
+	Success bool `json:"success"`
+	// Data is the payload of a successful response.
+	Data interface{} `json:"data,omitempty"`
+	// Error describes why the request failed.
+	Error *APIError `json:"error,omitempty"`
+	// RequestID is the ID of the request.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// APIError is the error model returned to the clients.
+type APIError struct {
+	// Code is a machine readable error code, e.g. "NOT_FOUND".
+	Code string `json:"code"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"-"`
+	// Message is a human readable description of the error.
+	Message string `json:"message"`
+	// Details carries extra information, e.g. the invalid fields.
+	Details interface{} `json:"details,omitempty"`
+	// RequestID is the ID of the request which failed.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// FieldError describes a field which failed the validation.
+type FieldError struct {
+	// Field is the name of the field as the client sent it.
+	Field string `json:"field"`
+	// Rule is the validation rule the field broke.
+	Rule string `json:"rule"`
+	// Message is a human readable description of the error.
+	Message string `json:"message"`
+}
+
+var (
+	ErrBadRequest         = NewError(http.StatusBadRequest, "BAD_REQUEST", "bad request")
+	ErrValidation         = NewError(http.StatusBadRequest, "VALIDATION_FAILED", "validation failed")
+	ErrUnauthorized       = NewError(http.StatusUnauthorized, "UNAUTHORIZED", "unauthorized")
+	ErrForbidden          = NewError(http.StatusForbidden, "FORBIDDEN", "forbidden")
+	ErrNotFound           = NewError(http.StatusNotFound, "NOT_FOUND", "not found")
+	ErrConflict           = NewError(http.StatusConflict, "CONFLICT", "conflict")
+	ErrPayloadTooLarge    = NewError(http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE", "request body too large")
+	ErrTooManyRequests    = NewError(http.StatusTooManyRequests, "TOO_MANY_REQUESTS", "too many requests")
+	ErrInternal           = NewError(http.StatusInternalServerError, "INTERNAL_ERROR", "internal server error")
+	ErrBadGateway         = NewError(http.StatusBadGateway, "BAD_GATEWAY", "bad gateway")
+	ErrServiceUnavailable = NewError(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "service unavailable")
+	ErrGatewayTimeout     = NewError(http.StatusGatewayTimeout, "GATEWAY_TIMEOUT", "request timed out")
+)
+
+// NewError creates an APIError.
+func NewError(status int, code string, message string) *APIError {
+	return &APIError{
+		Code:    code,
+		Status:  status,
+		Message: message,
+	}
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Is reports whether target is an APIError with the same code.
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage returns a copy of the error with the message replaced.
+func (e *APIError) WithMessage(message string) *APIError {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// WithDetails returns a copy of the error with the details attached.
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// FromError converts err to an APIError, errors which are not an
+// APIError are reported as ErrInternal to avoid leaking internals.
+func FromError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		c := *apiErr
+		return &c
+	}
+	c := *ErrInternal
+	return &c
+}
+
+// Success creates the envelope of a successful response.
+func Success(data interface{}, requestID string) Response {
+	return Response{
+		Success:   true,
+		Data:      data,
+		RequestID: requestID,
+	}
+}
+
+// Failure creates the envelope of a failed response.
+func Failure(err *APIError, requestID string) Response {
+	c := *err
+	c.RequestID = requestID
+	return Response{
+		Success: false,
+		Error:   &c,
+	}
+}
@@ -0,0 +1,36 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", ErrNotFound.WithMessage("user not found"))
+	apiErr := FromError(err)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+	assert.Equal(t, "user not found", apiErr.Message)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	apiErr = FromError(errors.New("db is down"))
+	assert.Equal(t, ErrInternal, apiErr)
+	assert.NotSame(t, ErrInternal, apiErr)
+}
+
+func TestEnvelope(t *testing.T) {
+	p, err := json.Marshal(Success(map[string]int{"n": 1}, "42"))
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"success":true,"data":{"n":1},"request_id":"42"}`, string(p))
+
+	details := []FieldError{{Field: "email", Rule: "email", Message: "email must be a valid email"}}
+	p, err = json.Marshal(Failure(ErrValidation.WithDetails(details), "42"))
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"success":false,"error":{"code":"VALIDATION_FAILED","message":"validation failed",
+		"details":[{"field":"email","rule":"email","message":"email must be a valid email"}],"request_id":"42"}}`, string(p))
+	assert.Empty(t, ErrValidation.RequestID)
+}
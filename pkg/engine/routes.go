@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrRouteInvalid is returned for a route spec missing its method, path
+	// or handler.
+	ErrRouteInvalid = errors.New("engine: invalid route")
+	// ErrRouteDuplicate is returned for a method and path registered twice.
+	ErrRouteDuplicate = errors.New("engine: duplicate route")
+	// ErrRouteConflict is returned for a route gin can't register next to
+	// the others, e.g. two different parameter names at the same segment.
+	ErrRouteConflict = errors.New("engine: conflicting route")
+	// ErrUnknownHandler is returned for a handler name which is not in the
+	// Handlers.
+	ErrUnknownHandler = errors.New("engine: unknown handler")
+)
+
+// RouteSpec declares a route.
+type RouteSpec struct {
+	Method       string
+	Path         string
+	ResourceType ResourceType
+	Handler      gin.HandlerFunc
+	Middlewares  []gin.HandlerFunc
+	// Timeout bounds the route if it's positive.
+	Timeout time.Duration
+}
+
+// Register registers the routes declared by specs under the group, it
+// registers none of them and returns every problem found if any route is
+// invalid, duplicated or conflicts with another one.
+func (rg RouterGroupWrapper) Register(specs []RouteSpec) error {
+	if err := rg.checkRoutes(specs); err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		group := rg
+		if spec.Timeout > 0 {
+			group = group.WithTimeout(spec.Timeout)
+		}
+		handlers := append(append([]gin.HandlerFunc{}, spec.Middlewares...), spec.Handler)
+		group.handle(strings.ToUpper(spec.Method), spec.Path, spec.ResourceType, handlers)
+	}
+	return nil
+}
+
+// Register registers the routes declared by specs at the root of e.
+func (e *Engine) Register(specs []RouteSpec) error {
+	return e.Group("").Register(specs)
+}
+
+// checkRoutes registers the routes of the engine and specs on a scratch
+// gin engine, so that the conflicts gin panics on are found before any
+// route is registered, as well as the ones reported by Validate if the
+// routes are strict.
+func (rg RouterGroupWrapper) checkRoutes(specs []RouteSpec) error {
+	scratch := gin.New()
+	for _, r := range rg.engine.Engine.Routes() {
+		_ = tryHandle(scratch, r.Method, r.Path)
+	}
+
+	rg.engine.mutex.RLock()
+	registered := append([]routeRegistration{}, rg.engine.registrations...)
+	rg.engine.mutex.RUnlock()
+
+	var errs []error
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		method := strings.ToUpper(spec.Method)
+		absolutePath := joinPaths(rg.BasePath(), spec.Path)
+		key := FormatRoute(method, absolutePath)
+
+		switch {
+		case method == "" || spec.Path == "" || spec.Handler == nil:
+			errs = append(errs, fmt.Errorf("%w: %s: method, path and handler are required", ErrRouteInvalid, key))
+		case seen[key]:
+			errs = append(errs, fmt.Errorf("%w: %s", ErrRouteDuplicate, key))
+		case rg.engine.hasRoute(method, absolutePath):
+			errs = append(errs, fmt.Errorf("%w: %s is already registered", ErrRouteDuplicate, key))
+		default:
+			if err := tryHandle(scratch, method, absolutePath); err != nil {
+				errs = append(errs, fmt.Errorf("%w: %s: %v", ErrRouteConflict, key, err))
+			}
+			reg := routeRegistration{method: method, path: absolutePath, typ: spec.ResourceType}
+			if rg.engine.strictRoutes {
+				if err := conflictsWith(reg, registered); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			registered = append(registered, reg)
+		}
+		seen[key] = true
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Engine) hasRoute(method string, absolutePath string) bool {
+	for _, r := range e.Engine.Routes() {
+		if r.Method == method && r.Path == absolutePath {
+			return true
+		}
+	}
+	return false
+}
+
+// tryHandle registers a route on g and turns the panic of gin into an
+// error.
+func tryHandle(g *gin.Engine, method string, absolutePath string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	g.Handle(method, absolutePath, func(*gin.Context) {})
+	return nil
+}
+
+// joinPaths joins the paths like gin does, keeping the trailing slash.
+func joinPaths(base string, relativePath string) string {
+	if relativePath == "" {
+		return base
+	}
+	joined := strings.TrimRight(base, "/") + "/" + strings.TrimLeft(relativePath, "/")
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// Handlers maps the names referenced by a routes file to the handlers and
+// middlewares.
+type Handlers map[string]gin.HandlerFunc
+
+type routesFile struct {
+	Routes []struct {
+		Method      string        `yaml:"method"`
+		Path        string        `yaml:"path"`
+		Scope       string        `yaml:"scope"`
+		Resource    string        `yaml:"resource"`
+		Handler     string        `yaml:"handler"`
+		Middlewares []string      `yaml:"middlewares"`
+		Timeout     time.Duration `yaml:"timeout"`
+	} `yaml:"routes"`
+}
+
+// LoadRoutes reads the route specs from a YAML file, see ParseRoutes.
+func LoadRoutes(path string, handlers Handlers) ([]RouteSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRoutes(data, handlers)
+}
+
+// ParseRoutes parses YAML route specs referencing handlers by name:
+//
+//	routes:
+//	  - method: GET
+//	    path: /users/:user_id
+//	    scope: management
+//	    resource: user
+//	    handler: getUser
+//	    middlewares: [audit]
+//	    timeout: 2s
+func ParseRoutes(data []byte, handlers Handlers) ([]RouteSpec, error) {
+	var f routesFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	lookup := func(route string, name string) gin.HandlerFunc {
+		h, ok := handlers[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: %s: %q", ErrUnknownHandler, route, name))
+		}
+		return h
+	}
+
+	specs := make([]RouteSpec, 0, len(f.Routes))
+	for _, r := range f.Routes {
+		route := FormatRoute(strings.ToUpper(r.Method), r.Path)
+		spec := RouteSpec{
+			Method:       r.Method,
+			Path:         r.Path,
+			ResourceType: ResourceType{Scope: ResourceScope(r.Scope), Resource: r.Resource},
+			Handler:      lookup(route, r.Handler),
+			Timeout:      r.Timeout,
+		}
+		for _, name := range r.Middlewares {
+			spec.Middlewares = append(spec.Middlewares, lookup(route, name))
+		}
+		specs = append(specs, spec)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	e := New()
+	ok := func(c *gin.Context) { c.String(http.StatusOK, c.FullPath()) }
+	tag := func(c *gin.Context) {
+		c.Header("X-Tag", "1")
+		c.Next()
+	}
+
+	err := e.Group("/api/v1").Register([]RouteSpec{
+		{Method: "get", Path: "/users/:user_id", ResourceType: userResourceType, Handler: ok, Middlewares: []gin.HandlerFunc{tag}},
+		{Method: http.MethodPost, Path: "/books", ResourceType: bookResourceType, Handler: ok, Timeout: time.Second},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, userResourceType, e.Routers["GET /api/v1/users/:user_id"])
+	assert.Equal(t, bookResourceType, e.Routers["POST /api/v1/books"])
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Tag"))
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/books", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, time.Second, e.routeMeta["POST /api/v1/books"].Timeout)
+
+	err = e.Register([]RouteSpec{
+		{Method: http.MethodGet, Path: "/api/v1/reviews", ResourceType: reviewResourceType, Handler: ok},
+		{Method: http.MethodGet, Path: "/api/v1/reviews", ResourceType: reviewResourceType, Handler: ok},
+		{Method: http.MethodGet, Path: "/api/v1/users/:id", ResourceType: userResourceType, Handler: ok},
+		{Method: http.MethodPost, Path: "/api/v1/books", ResourceType: bookResourceType, Handler: ok},
+		{Method: http.MethodGet, Path: "/api/v1/empty", ResourceType: bookResourceType},
+	})
+	assert.ErrorIs(t, err, ErrRouteDuplicate)
+	assert.ErrorIs(t, err, ErrRouteConflict)
+	assert.ErrorIs(t, err, ErrRouteInvalid)
+	assert.Contains(t, err.Error(), "GET /api/v1/reviews")
+	assert.Contains(t, err.Error(), "GET /api/v1/users/:id")
+	assert.Contains(t, err.Error(), "POST /api/v1/books is already registered")
+
+	// nothing was registered
+	_, found := e.Routers["GET /api/v1/reviews"]
+	assert.False(t, found)
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/reviews", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestLoadRoutes(t *testing.T) {
+	handlers := Handlers{
+		"getUser": func(c *gin.Context) { c.String(http.StatusOK, c.Param("user_id")) },
+		"tag": func(c *gin.Context) {
+			c.Header("X-Tag", "1")
+			c.Next()
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(`
+routes:
+  - method: GET
+    path: /api/v1/users/:user_id
+    scope: management
+    resource: user
+    handler: getUser
+    middlewares: [tag]
+    timeout: 2s
+`), 0o600))
+
+	specs, err := LoadRoutes(path, handlers)
+	assert.Nil(t, err)
+	assert.Len(t, specs, 1)
+	assert.Equal(t, userResourceType, specs[0].ResourceType)
+	assert.Equal(t, 2*time.Second, specs[0].Timeout)
+	assert.Len(t, specs[0].Middlewares, 1)
+
+	e := New()
+	assert.Nil(t, e.Register(specs))
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users/7", nil))
+	assert.Equal(t, "7", w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("X-Tag"))
+
+	_, err = ParseRoutes([]byte(`
+routes:
+  - {method: GET, path: /a, handler: missing, middlewares: [alsoMissing]}
+`), handlers)
+	assert.ErrorIs(t, err, ErrUnknownHandler)
+	assert.Contains(t, err.Error(), `"missing"`)
+	assert.Contains(t, err.Error(), `"alsoMissing"`)
+
+	_, err = ParseRoutes([]byte(`routes: [`), handlers)
+	assert.Error(t, err)
+	_, err = LoadRoutes(filepath.Join(t.TempDir(), "missing.yaml"), handlers)
+	assert.Error(t, err)
+}
@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	bodyLimitContextKey = "engine/body-limit"
+)
+
+var (
+	defaultCORSMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions,
+	}
+	defaultCORSHeaders = []string{
+		"Origin", "Accept", "Content-Type", "Authorization", HeaderRequestID, HeaderAPIKey,
+	}
+)
+
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// AllowOrigins are the allowed origins, "*" allows any origin and a
+	// single "*" in an origin matches a subdomain, e.g. "https://*.example.com".
+	AllowOrigins []string
+	// AllowMethods are the methods allowed in the preflight requests.
+	AllowMethods []string
+	// AllowHeaders are the headers allowed in the preflight requests.
+	AllowHeaders []string
+	// ExposeHeaders are the response headers exposed to the scripts.
+	ExposeHeaders []string
+	// AllowCredentials allows cookies and the Authorization header, it can't
+	// be combined with the "*" origin.
+	AllowCredentials bool
+	// MaxAge is how long the preflight responses can be cached.
+	MaxAge time.Duration
+}
+
+func (o *CORSOptions) allowOrigin(origin string) bool {
+	for _, allowed := range o.AllowOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		prefix, suffix, ok := strings.Cut(allowed, "*")
+		if ok && len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS returns a middleware which handles the cross-origin requests and
+// answers the preflight requests, it should be installed with Engine.Use
+// so the preflight requests of every route reach it. It panics if the
+// credentials are allowed for any origin.
+func CORS(opts CORSOptions) gin.HandlerFunc {
+	if opts.AllowCredentials && containsFold(opts.AllowOrigins, "*") {
+		panic("engine: CORS credentials can't be allowed for the \"*\" origin")
+	}
+	if len(opts.AllowMethods) == 0 {
+		opts.AllowMethods = defaultCORSMethods
+	}
+	if len(opts.AllowHeaders) == 0 {
+		opts.AllowHeaders = defaultCORSHeaders
+	}
+	allowMethods := strings.Join(opts.AllowMethods, ", ")
+	allowHeaders := strings.Join(opts.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(opts.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+
+		ctx.Writer.Header().Add("Vary", "Origin")
+		preflight := ctx.Request.Method == http.MethodOptions &&
+			ctx.GetHeader("Access-Control-Request-Method") != ""
+
+		if !opts.allowOrigin(origin) {
+			if preflight {
+				Fail(ctx, response.ErrForbidden.WithMessage("origin is not allowed"))
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		if containsFold(opts.AllowOrigins, "*") {
+			ctx.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			ctx.Header("Access-Control-Allow-Origin", origin)
+		}
+		if opts.AllowCredentials {
+			ctx.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				ctx.Header("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("Access-Control-Allow-Methods", allowMethods)
+		ctx.Header("Access-Control-Allow-Headers", allowHeaders)
+		if opts.MaxAge > 0 {
+			ctx.Header("Access-Control-Max-Age", maxAge)
+		}
+		ctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// SecurityHeadersOptions configures the SecurityHeaders middleware.
+type SecurityHeadersOptions struct {
+	// HSTSMaxAge enables Strict-Transport-Security if it's positive.
+	HSTSMaxAge time.Duration
+	// HSTSIncludeSubdomains applies HSTS to the subdomains.
+	HSTSIncludeSubdomains bool
+	// HSTSPreload allows the domain to be preloaded by the browsers.
+	HSTSPreload bool
+	// ContentSecurityPolicy is the Content-Security-Policy header, not set if it's empty.
+	ContentSecurityPolicy string
+	// FrameOptions is the X-Frame-Options header, "DENY" by default.
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy header, "strict-origin-when-cross-origin" by default.
+	ReferrerPolicy string
+}
+
+// SecurityHeaders returns a middleware which sets the common security
+// headers, X-Content-Type-Options is always "nosniff".
+func SecurityHeaders(opts SecurityHeadersOptions) gin.HandlerFunc {
+	if opts.FrameOptions == "" {
+		opts.FrameOptions = "DENY"
+	}
+	if opts.ReferrerPolicy == "" {
+		opts.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+
+	var hsts string
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(opts.HSTSMaxAge.Seconds()))
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if opts.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	return func(ctx *gin.Context) {
+		h := ctx.Writer.Header()
+		if hsts != "" {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		if opts.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", opts.ContentSecurityPolicy)
+		}
+		h.Set("X-Frame-Options", opts.FrameOptions)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", opts.ReferrerPolicy)
+		ctx.Next()
+	}
+}
+
+// BodyLimit returns a middleware which rejects the request bodies larger
+// than max bytes with ErrPayloadTooLarge. Bodies without a Content-Length
+// fail when the handler reads past the limit, Bind and ErrorHandler report
+// that as ErrPayloadTooLarge too. The limit also applies to the bodies
+// decompressed by Compress.
+func BodyLimit(max int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.ContentLength > max {
+			Fail(ctx, response.ErrPayloadTooLarge)
+			return
+		}
+		ctx.Set(bodyLimitContextKey, max)
+		if ctx.Request.Body != nil {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, max)
+		}
+		ctx.Next()
+	}
+}
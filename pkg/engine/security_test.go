@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	e := New()
+	e.Use(CORS(CORSOptions{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+		ExposeHeaders:    []string{HeaderRequestID},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	e.Group("/api/v1").GET("/users", userResourceType, func(c *gin.Context) {})
+
+	do := func(method, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/v1/users", nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "https://app.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, HeaderRequestID, w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	w = do(http.MethodOptions, "https://a.example.org")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://a.example.org", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), http.MethodPatch)
+
+	w = do(http.MethodOptions, "https://.example.org")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do(http.MethodGet, "https://evil.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	assert.Panics(t, func() {
+		CORS(CORSOptions{AllowOrigins: []string{"*"}, AllowCredentials: true})
+	})
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	e := New()
+	e.Use(SecurityHeaders(SecurityHeadersOptions{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'self'",
+	}))
+	e.Group("/").GET("/", userResourceType, func(c *gin.Context) {})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "default-src 'self'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+}
+
+func TestBodyLimit(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	e := New()
+	e.Use(BodyLimit(16))
+	group := e.Group("/api/v1")
+	group.POST("/users", userResourceType, func(c *gin.Context) {
+		if _, ok := MustBind[user](c); ok {
+			OK(c, nil)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"name":"a"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"name":"alexander"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "PAYLOAD_TOO_LARGE", decodeResponse(t, w).Error.Code)
+
+	// without Content-Length the limit is hit while reading
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users", io.NopCloser(strings.NewReader(`{"name":"alexander"}`)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/json")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "PAYLOAD_TOO_LARGE", decodeResponse(t, w).Error.Code)
+}
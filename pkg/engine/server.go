@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAddr            = ":8080"
+	defaultReadTimeout     = 15 * time.Second
+	defaultWriteTimeout    = 30 * time.Second
+	defaultIdleTimeout     = 60 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+	defaultStopTimeout     = 10 * time.Second
+)
+
+// Hook is a function called when the engine starts or stops serving.
+type Hook func(ctx context.Context) error
+
+// ServeOptions configures how Engine.Serve runs the HTTP server,
+// zero values are replaced by the defaults.
+type ServeOptions struct {
+	// Addr is the TCP address to listen on, ":8080" by default.
+	Addr string
+	// ReadTimeout is the maximum duration for reading the entire request.
+	ReadTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out writes of the response.
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum amount of time to wait for the next request
+	// when keep-alives are enabled.
+	IdleTimeout time.Duration
+	// ShutdownTimeout is the deadline for draining in-flight requests.
+	ShutdownTimeout time.Duration
+	// StopTimeout is the deadline for the OnStop hooks, which run after the
+	// drain, 10s by default.
+	StopTimeout time.Duration
+	// ShutdownDelay is how long the engine keeps serving after it reports
+	// not ready, which gives load balancers time to stop routing traffic.
+	ShutdownDelay time.Duration
+	// Signals are the signals which trigger a graceful shutdown,
+	// SIGINT and SIGTERM by default.
+	Signals []os.Signal
+}
+
+func (opts ServeOptions) withDefaults() ServeOptions {
+	if opts.Addr == "" {
+		opts.Addr = defaultAddr
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = defaultReadTimeout
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaultWriteTimeout
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if opts.StopTimeout <= 0 {
+		opts.StopTimeout = defaultStopTimeout
+	}
+	if len(opts.Signals) == 0 {
+		opts.Signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	return opts
+}
+
+// lifecycle keeps the hooks and the serving state of an Engine.
+type lifecycle struct {
+	onStart    []Hook
+	onStop     []Hook
+	onShutdown []func()
+
+	ready        atomic.Bool
+	shuttingDown atomic.Bool
+}
+
+// OnStart registers a hook which runs before the engine starts listening,
+// any error aborts Serve.
+func (e *Engine) OnStart(hook Hook) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lifecycle.onStart = append(e.lifecycle.onStart, hook)
+}
+
+// OnStop registers a hook which runs after in-flight requests are drained,
+// hooks run in the reverse order of registration within StopTimeout.
+func (e *Engine) OnStop(hook Hook) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lifecycle.onStop = append(e.lifecycle.onStop, hook)
+}
+
+// onShutdown registers fn to run as soon as the shutdown begins, it's
+// meant to end the long-lived requests which would hold the drain.
+func (e *Engine) onShutdown(fn func()) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lifecycle.onShutdown = append(e.lifecycle.onShutdown, fn)
+}
+
+// Ready reports whether the engine is serving and not shutting down.
+func (e *Engine) Ready() bool {
+	return e.lifecycle.ready.Load()
+}
+
+// ShuttingDown reports whether the engine is in its graceful shutdown window.
+func (e *Engine) ShuttingDown() bool {
+	return e.lifecycle.shuttingDown.Load()
+}
+
+// Serve runs the engine with an http.Server until ctx is done or one of the
+// shutdown signals is received, then drains in-flight requests within
+// ShutdownTimeout and runs the OnStop hooks.
+func (e *Engine) Serve(ctx context.Context, opts ServeOptions) error {
+	o := opts.withDefaults()
+
+	ln, err := net.Listen("tcp", o.Addr)
+	if err != nil {
+		return err
+	}
+	return e.serve(ctx, ln, o)
+}
+
+func (e *Engine) serve(ctx context.Context, ln net.Listener, o ServeOptions) error {
+	e.mutex.RLock()
+	onStart := append([]Hook(nil), e.lifecycle.onStart...)
+	onStop := append([]Hook(nil), e.lifecycle.onStop...)
+	onShutdown := append([]func(){}, e.lifecycle.onShutdown...)
+	e.mutex.RUnlock()
+
+	for _, hook := range onStart {
+		if err := hook(ctx); err != nil {
+			_ = ln.Close()
+			return err
+		}
+	}
+
+	srv := &http.Server{
+		Handler:      e,
+		ReadTimeout:  o.ReadTimeout,
+		WriteTimeout: o.WriteTimeout,
+		IdleTimeout:  o.IdleTimeout,
+	}
+	for _, fn := range onShutdown {
+		srv.RegisterOnShutdown(fn)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, o.Signals...)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	e.lifecycle.shuttingDown.Store(false)
+	e.lifecycle.ready.Store(true)
+	e.logger.Infow("engine started", zap.String("addr", ln.Addr().String()))
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errCh:
+	}
+
+	e.lifecycle.ready.Store(false)
+	e.lifecycle.shuttingDown.Store(true)
+	defer e.lifecycle.shuttingDown.Store(false)
+	e.logger.Infow("engine shutting down", zap.Duration("timeout", o.ShutdownTimeout))
+
+	if serveErr == nil && o.ShutdownDelay > 0 {
+		time.Sleep(o.ShutdownDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), o.ShutdownTimeout)
+	defer cancel()
+
+	errs := []error{}
+	if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		errs = append(errs, serveErr)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), o.StopTimeout)
+	defer stopCancel()
+	for i := len(onStop) - 1; i >= 0; i-- {
+		if err := onStop[i](stopCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
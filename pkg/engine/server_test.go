@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeGracefulShutdown(t *testing.T) {
+	logger, _ := newTestLogger(t)
+	e := New(WithLogger(logger))
+
+	started := make(chan struct{})
+	group := e.Group("/api/v1")
+	group.GET("/slow", userResourceType, func(c *gin.Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	var calls []string
+	e.OnStart(func(ctx context.Context) error {
+		calls = append(calls, "start")
+		return nil
+	})
+	e.OnStop(func(ctx context.Context) error {
+		calls = append(calls, "stop1")
+		return nil
+	})
+	e.OnStop(func(ctx context.Context) error {
+		calls = append(calls, "stop2")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- e.serve(ctx, ln, ServeOptions{}.withDefaults())
+	}()
+
+	assert.Eventually(t, e.Ready, time.Second, 5*time.Millisecond)
+
+	respCh := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/api/v1/slow")
+		assert.Nil(t, err)
+		respCh <- resp
+	}()
+
+	<-started
+	cancel()
+
+	resp := <-respCh
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+
+	assert.Nil(t, <-done)
+	assert.False(t, e.Ready())
+	assert.Equal(t, []string{"start", "stop2", "stop1"}, calls)
+}
+
+func TestServeStartHookFailed(t *testing.T) {
+	e := New()
+	e.OnStart(func(ctx context.Context) error {
+		return errors.New("start failed")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	err = e.serve(context.Background(), ln, ServeOptions{}.withDefaults())
+	assert.EqualError(t, err, "start failed")
+	assert.False(t, e.Ready())
+}
+
+func TestServeStopHookDeadline(t *testing.T) {
+	logger, _ := newTestLogger(t)
+	e := New(WithLogger(logger))
+
+	started := make(chan struct{})
+	e.Group("/api/v1").GET("/stuck", userResourceType, func(c *gin.Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	var hookErr error
+	e.OnStop(func(ctx context.Context) error {
+		hookErr = ctx.Err()
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- e.serve(ctx, ln, ServeOptions{ShutdownTimeout: 20 * time.Millisecond}.withDefaults())
+	}()
+	assert.Eventually(t, e.Ready, time.Second, 5*time.Millisecond)
+
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/api/v1/stuck")
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	assert.Nil(t, hookErr)
+}
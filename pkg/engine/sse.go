@@ -0,0 +1,338 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HeaderLastEventID = "Last-Event-ID"
+
+	defaultReplaySize   = 256
+	defaultClientBuffer = 16
+	defaultHeartbeat    = 15 * time.Second
+	defaultTopicIdle    = 10 * time.Minute
+)
+
+var (
+	ErrEventInvalid = errors.New("event type must not contain CR or LF")
+
+	// lineBreaks normalizes the line breaks of the data, the clients
+	// split the lines on CR too.
+	lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+)
+
+// Event is a Server-Sent Event.
+type Event struct {
+	// ID is assigned by the Hub when the event is published.
+	ID string
+	// Event is the event type, "message" if empty.
+	Event string
+	// Data is the payload, it may span multiple lines.
+	Data string
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+
+	seq uint64
+}
+
+// writeTo writes the event in the text/event-stream format.
+func (ev Event) writeTo(w gin.ResponseWriter) error {
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + ev.ID + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + ev.Event + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range strings.Split(lineBreaks.Replace(ev.Data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := w.WriteString(b.String())
+	return err
+}
+
+// TopicFunc returns the topic a request subscribes to, "" rejects the
+// request with 404.
+type TopicFunc func(ctx *gin.Context) string
+
+// StaticTopic subscribes every request to topic.
+func StaticTopic(topic string) TopicFunc {
+	return func(*gin.Context) string {
+		return topic
+	}
+}
+
+// TopicFromParam subscribes to the topic named by the path parameter name.
+func TopicFromParam(name string) TopicFunc {
+	return func(ctx *gin.Context) string {
+		return ctx.Param(name)
+	}
+}
+
+// HubOptions configures a Hub.
+type HubOptions struct {
+	// ReplaySize is the number of events kept per topic to resume the
+	// clients sending Last-Event-ID, 256 by default.
+	ReplaySize int
+	// ClientBuffer is the size of the channel of every client, 16 by
+	// default. A client falling behind is disconnected, it resumes from
+	// the replay buffer once it reconnects.
+	ClientBuffer int
+	// Heartbeat is the interval of the pings keeping the connections
+	// open, 15s by default.
+	Heartbeat time.Duration
+	// IdleTimeout is how long a topic without subscribers keeps its
+	// replay buffer after its last activity, 10m by default.
+	IdleTimeout time.Duration
+}
+
+type sseClient struct {
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (c *sseClient) close() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
+
+type topic struct {
+	seq     uint64
+	replay  []Event
+	clients map[*sseClient]struct{}
+	active  time.Time
+}
+
+// Hub broadcasts the events published on a topic to its subscribers.
+type Hub struct {
+	opts HubOptions
+
+	mutex     sync.Mutex
+	topics    map[string]*topic
+	closed    bool
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewHub creates a Hub whose clients are disconnected as soon as the
+// engine begins to shut down.
+func (e *Engine) NewHub(opts HubOptions) *Hub {
+	if opts.ReplaySize <= 0 {
+		opts.ReplaySize = defaultReplaySize
+	}
+	if opts.ClientBuffer <= 0 {
+		opts.ClientBuffer = defaultClientBuffer
+	}
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = defaultHeartbeat
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultTopicIdle
+	}
+
+	h := &Hub{opts: opts, topics: make(map[string]*topic), now: time.Now}
+	e.onShutdown(h.Close)
+	return h
+}
+
+// sweep frees the topics which have no subscribers and were idle for
+// IdleTimeout, with their replay buffer.
+func (h *Hub) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	h.lastSweep = now
+	for name, t := range h.topics {
+		if len(t.clients) == 0 && now.Sub(t.active) > h.opts.IdleTimeout {
+			delete(h.topics, name)
+		}
+	}
+}
+
+func (h *Hub) topic(name string) *topic {
+	h.sweep(h.now())
+	t, ok := h.topics[name]
+	if !ok {
+		t = &topic{clients: make(map[*sseClient]struct{})}
+		h.topics[name] = t
+	}
+	return t
+}
+
+// Publish sends ev to the subscribers of name and returns it with its ID.
+// It fails with ErrEventInvalid if the event type spans multiple lines.
+func (h *Hub) Publish(name string, ev Event) (Event, error) {
+	if strings.ContainsAny(ev.Event, "\r\n") {
+		return ev, ErrEventInvalid
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return ev, nil
+	}
+
+	t := h.topic(name)
+	t.active = h.now()
+	t.seq++
+	ev.seq = t.seq
+	ev.ID = strconv.FormatUint(t.seq, 10)
+
+	t.replay = append(t.replay, ev)
+	if len(t.replay) > h.opts.ReplaySize {
+		t.replay = append(t.replay[:0:0], t.replay[len(t.replay)-h.opts.ReplaySize:]...)
+	}
+
+	for c := range t.clients {
+		select {
+		case c.events <- ev:
+		default:
+			delete(t.clients, c)
+			c.close()
+		}
+	}
+	return ev, nil
+}
+
+// Subscribers returns the number of clients subscribed to name.
+func (h *Hub) Subscribers(name string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if t, ok := h.topics[name]; ok {
+		return len(t.clients)
+	}
+	return 0
+}
+
+// Close disconnects every client, the events published afterwards are
+// dropped.
+func (h *Hub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.closed = true
+	for _, t := range h.topics {
+		for c := range t.clients {
+			c.close()
+		}
+		t.clients = nil
+	}
+}
+
+// subscribe registers a client on name and returns the events published
+// after lastEventID.
+func (h *Hub) subscribe(name string, lastEventID string) (*sseClient, []Event, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return nil, nil, false
+	}
+
+	t := h.topic(name)
+	var replay []Event
+	if last, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		for _, ev := range t.replay {
+			if ev.seq > last {
+				replay = append(replay, ev)
+			}
+		}
+	}
+
+	c := &sseClient{
+		events: make(chan Event, h.opts.ClientBuffer),
+		done:   make(chan struct{}),
+	}
+	t.clients[c] = struct{}{}
+	return c, replay, true
+}
+
+func (h *Hub) unsubscribe(name string, c *sseClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if t, ok := h.topics[name]; ok {
+		delete(t.clients, c)
+		t.active = h.now()
+		if len(t.clients) == 0 && len(t.replay) == 0 {
+			delete(h.topics, name)
+		}
+	}
+	c.close()
+}
+
+// SSE registers a GET route streaming the events of the topic resolved by
+// topic from hub, handlers run before the stream starts, e.g. to authorize
+// the subscription. A client sending Last-Event-ID first receives the
+// events it missed which are still in the replay buffer.
+func (rg RouterGroupWrapper) SSE(relativePath string, typ ResourceType, hub *Hub, topic TopicFunc, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return rg.GET(relativePath, typ, append(handlers, hub.stream(topic))...)
+}
+
+func (h *Hub) stream(topic TopicFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		name := topic(ctx)
+		if name == "" {
+			Fail(ctx, response.ErrNotFound)
+			return
+		}
+
+		client, replay, ok := h.subscribe(name, ctx.GetHeader(HeaderLastEventID))
+		if !ok {
+			Fail(ctx, response.ErrServiceUnavailable)
+			return
+		}
+		defer h.unsubscribe(name, client)
+
+		header := ctx.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		// the stream outlives the WriteTimeout of the server
+		_ = http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+		ctx.Writer.WriteHeader(http.StatusOK)
+		ctx.Writer.WriteHeaderNow()
+		ctx.Writer.Flush()
+
+		for _, ev := range replay {
+			if ev.writeTo(ctx.Writer) != nil {
+				return
+			}
+		}
+		ctx.Writer.Flush()
+
+		heartbeat := time.NewTicker(h.opts.Heartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Request.Context().Done():
+				return
+			case <-client.done:
+				return
+			case ev := <-client.events:
+				if ev.writeTo(ctx.Writer) != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := ctx.Writer.WriteString(": ping\n\n"); err != nil {
+					return
+				}
+			}
+			ctx.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readEvent reads the next event of the stream and counts the pings
+// preceding it.
+func readEvent(t *testing.T, r *bufio.Reader) ([]string, int) {
+	var lines []string
+	pings := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == ": ping":
+			pings++
+		case line == "" && len(lines) > 0:
+			return lines, pings
+		case line != "":
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestSSE(t *testing.T) {
+	logger, _ := newTestLogger(t)
+	e := New(WithLogger(logger))
+	hub := e.NewHub(HubOptions{ReplaySize: 2, Heartbeat: 20 * time.Millisecond})
+
+	group := e.Group("/api/v1")
+	group.SSE("/jobs/:job_id/events", bookResourceType, hub, TopicFromParam("job_id"))
+	assert.Equal(t, bookResourceType, e.Routers["GET /api/v1/jobs/:job_id/events"])
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		// the stream must outlive the write timeout
+		done <- e.serve(ctx, ln, ServeOptions{WriteTimeout: 30 * time.Millisecond}.withDefaults())
+	}()
+	assert.Eventually(t, e.Ready, time.Second, 5*time.Millisecond)
+
+	subscribe := func(lastEventID string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+"/api/v1/jobs/42/events", nil)
+		assert.Nil(t, err)
+		if lastEventID != "" {
+			req.Header.Set(HeaderLastEventID, lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return resp
+	}
+
+	resp := subscribe("")
+	assert.Eventually(t, func() bool { return hub.Subscribers("42") == 1 }, time.Second, 5*time.Millisecond)
+
+	_, err = hub.Publish("42", Event{Event: "progress", Data: "10"})
+	assert.Nil(t, err)
+	_, err = hub.Publish("42", Event{Event: "progress\ndata: forged"})
+	assert.Equal(t, ErrEventInvalid, err)
+	hub.Publish("42", Event{Data: "line1\r\nline2"})
+	hub.Publish("42", Event{Data: "done", Retry: time.Second})
+	hub.Publish("other", Event{Data: "ignored"})
+
+	r := bufio.NewReader(resp.Body)
+	ev, _ := readEvent(t, r)
+	assert.Equal(t, []string{"id: 1", "event: progress", "data: 10"}, ev)
+	ev, _ = readEvent(t, r)
+	assert.Equal(t, []string{"id: 2", "data: line1", "data: line2"}, ev)
+	ev, _ = readEvent(t, r)
+	assert.Equal(t, []string{"id: 3", "retry: 1000", "data: done"}, ev)
+
+	time.Sleep(50 * time.Millisecond)
+	hub.Publish("42", Event{Data: "4"})
+	ev, pings := readEvent(t, r)
+	assert.Equal(t, []string{"id: 4", "data: 4"}, ev)
+	assert.Greater(t, pings, 0)
+
+	_ = resp.Body.Close()
+	assert.Eventually(t, func() bool { return hub.Subscribers("42") == 0 }, time.Second, 5*time.Millisecond)
+
+	// the replay buffer only keeps the last two events
+	resp = subscribe("1")
+	r = bufio.NewReader(resp.Body)
+	ev, _ = readEvent(t, r)
+	assert.Equal(t, []string{"id: 3", "retry: 1000", "data: done"}, ev)
+	ev, _ = readEvent(t, r)
+	assert.Equal(t, []string{"id: 4", "data: 4"}, ev)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown was held by the stream")
+	}
+	_, err = io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, 0, hub.Subscribers("42"))
+}
+
+func TestHubIdleTopics(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	hub := New().NewHub(HubOptions{IdleTimeout: time.Minute})
+	hub.now = clock.Now
+
+	hub.Publish("idle", Event{Data: "1"})
+	c, _, ok := hub.subscribe("busy", "")
+	assert.True(t, ok)
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	hub.Publish("other", Event{Data: "1"})
+	assert.NotContains(t, hub.topics, "idle")
+	assert.Contains(t, hub.topics, "busy", "topics with subscribers are kept")
+
+	hub.unsubscribe("busy", c)
+	assert.NotContains(t, hub.topics, "busy")
+}
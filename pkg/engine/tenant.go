@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// HeaderTenantID is the default header carrying the tenant.
+	HeaderTenantID = "X-Tenant-ID"
+	// TenantColumn is the column TenantScope filters on.
+	TenantColumn = "tenant_id"
+
+	tenantContextKey = "engine/tenant"
+)
+
+var (
+	ErrTenantRequired = response.NewError(http.StatusBadRequest, "TENANT_REQUIRED", "tenant is required")
+	ErrTenantMismatch = response.NewError(http.StatusForbidden, "TENANT_MISMATCH", "tenant does not match the principal")
+
+	// ErrTenantMissing is added to the queries scoped by TenantScope whose
+	// context carries no tenant.
+	ErrTenantMissing = errors.New("engine: tenant missing in context")
+)
+
+type tenantKey struct{}
+
+// TenantResolver resolves the tenant of the request, it returns "" if
+// the request doesn't carry one.
+type TenantResolver func(ctx *gin.Context) string
+
+// TenantFromHeader resolves the tenant from the header name, "X-Tenant-ID"
+// if empty.
+func TenantFromHeader(name string) TenantResolver {
+	if name == "" {
+		name = HeaderTenantID
+	}
+	return func(ctx *gin.Context) string {
+		return strings.TrimSpace(ctx.GetHeader(name))
+	}
+}
+
+// TenantFromSubdomain resolves the tenant from the subdomain of the host
+// under baseDomain, e.g. "acme" for "acme.example.com".
+func TenantFromSubdomain(baseDomain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+	return func(ctx *gin.Context) string {
+		host := ctx.Request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+		if !strings.HasSuffix(host, suffix) {
+			return ""
+		}
+		sub := strings.TrimSuffix(host, suffix)
+		if strings.Contains(sub, ".") {
+			return ""
+		}
+		return sub
+	}
+}
+
+// TenantFromPrincipal resolves the tenant from the authenticated
+// principal, i.e. from the tenant claim of its JWT.
+func TenantFromPrincipal() TenantResolver {
+	return func(ctx *gin.Context) string {
+		if p, ok := PrincipalFrom(ctx); ok {
+			return p.Tenant
+		}
+		return ""
+	}
+}
+
+// TenantFromPathPrefix resolves the tenant from the path segment following
+// prefix, e.g. "acme" for "/t/acme/api/v1/users" with the prefix "/t". The
+// path is routed as it is, so the routes must declare the tenant segment,
+// e.g. in a group registered with e.Group("/t/:tenant").
+func TenantFromPathPrefix(prefix string) TenantResolver {
+	prefix = "/" + strings.Trim(prefix, "/") + "/"
+	if prefix == "//" {
+		prefix = "/"
+	}
+	return func(ctx *gin.Context) string {
+		rest := strings.TrimPrefix(ctx.Request.URL.Path, prefix)
+		if len(rest) == len(ctx.Request.URL.Path) {
+			return ""
+		}
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			rest = rest[:i]
+		}
+		return rest
+	}
+}
+
+// SetTenant stores tenant in both the gin context and the request context.
+func SetTenant(ctx *gin.Context, tenant string) {
+	ctx.Set(tenantContextKey, tenant)
+	ctx.Request = ctx.Request.WithContext(WithTenant(ctx.Request.Context(), tenant))
+}
+
+// TenantFrom returns the tenant stored in the gin context, or the one
+// carried by the request context.
+func TenantFrom(ctx *gin.Context) (string, bool) {
+	if v, ok := ctx.Get(tenantContextKey); ok {
+		tenant, ok := v.(string)
+		return tenant, ok
+	}
+	if ctx.Request == nil {
+		return "", false
+	}
+	return TenantFromContext(ctx.Request.Context())
+}
+
+// WithTenant returns a copy of ctx carrying tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// Global returns a group sharing the path of rg whose routes are not
+// scoped to a tenant.
+func (rg RouterGroupWrapper) Global() RouterGroupWrapper {
+	group := rg.Group("")
+	group.meta.Global = true
+	return group
+}
+
+// TenantOptions configures the Tenant middleware.
+type TenantOptions struct {
+	// Resolvers are tried in order, the first tenant found is used. The
+	// "X-Tenant-ID" header is used if empty.
+	Resolvers []TenantResolver
+	// AllowUnboundPrincipals lets the principals without a tenant, e.g. the
+	// API keys, act on any tenant resolved from the request. They are
+	// rejected with 403 by default.
+	AllowUnboundPrincipals bool
+}
+
+// Tenant returns a middleware which resolves the tenant of the request and
+// stores it in the context. The routes are tenant-scoped unless they were
+// registered on a Global group, a tenant-scoped route is rejected with 400
+// if no tenant is resolved. Every route, Global ones included, is rejected
+// with 403 if the tenant is not the one of the authenticated principal, or
+// if the principal has no tenant unless AllowUnboundPrincipals is set.
+func (e *Engine) Tenant(opts TenantOptions) gin.HandlerFunc {
+	if len(opts.Resolvers) == 0 {
+		opts.Resolvers = []TenantResolver{TenantFromHeader("")}
+	}
+
+	return func(ctx *gin.Context) {
+		var tenant string
+		for _, resolve := range opts.Resolvers {
+			if tenant = resolve(ctx); tenant != "" {
+				break
+			}
+		}
+
+		meta, matched := e.RouteMetaOf(ctx)
+		scoped := matched && !meta.Global
+		if tenant == "" {
+			if scoped {
+				Fail(ctx, ErrTenantRequired)
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		if p, ok := PrincipalFrom(ctx); ok && p.Tenant != tenant &&
+			(p.Tenant != "" || !opts.AllowUnboundPrincipals) {
+			Fail(ctx, ErrTenantMismatch)
+			return
+		}
+
+		SetTenant(ctx, tenant)
+		ctx.Next()
+	}
+}
+
+// TenantScope is a gorm scope which restricts the query to the tenant
+// carried by the statement context, set it with db.WithContext. The query
+// fails with ErrTenantMissing if there is no tenant.
+//
+//	db.WithContext(ctx.Request.Context()).Scopes(engine.TenantScope).Find(&users)
+func TenantScope(db *gorm.DB) *gorm.DB {
+	tenant, ok := TenantFromContext(db.Statement.Context)
+	if !ok {
+		_ = db.AddError(ErrTenantMissing)
+		return db
+	}
+	return db.Where(clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: TenantColumn},
+		Value:  tenant,
+	})
+}
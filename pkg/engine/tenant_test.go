@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/daemgo/gopkg/pkg/mock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantResolvers(t *testing.T) {
+	newCtx := func(target string, host string) *gin.Context {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, target, nil)
+		ctx.Request.Host = host
+		ctx.Request.Header.Set(HeaderTenantID, " acme ")
+		return ctx
+	}
+
+	ctx := newCtx("/t/acme/api/v1/users", "acme.example.com:8080")
+	assert.Equal(t, "acme", TenantFromHeader("")(ctx))
+	assert.Equal(t, "acme", TenantFromSubdomain("example.com")(ctx))
+	assert.Equal(t, "acme", TenantFromPathPrefix("/t")(ctx))
+	assert.Equal(t, "", TenantFromPrincipal()(ctx))
+	SetPrincipal(ctx, &Principal{Subject: "1", Tenant: "acme"})
+	assert.Equal(t, "acme", TenantFromPrincipal()(ctx))
+
+	ctx = newCtx("/api/v1/users", "a.b.example.com")
+	assert.Equal(t, "", TenantFromSubdomain("example.com")(ctx))
+	assert.Equal(t, "", TenantFromPathPrefix("/t")(ctx))
+	ctx.Request.Host = "example.com"
+	assert.Equal(t, "", TenantFromSubdomain("example.com")(ctx))
+}
+
+func TestTenant(t *testing.T) {
+	e := New()
+	e.Use(injectPrincipal(), e.Tenant(TenantOptions{}))
+
+	group := e.Group("/api/v1")
+	group.GET("/users", userResourceType, func(c *gin.Context) {
+		tenant, _ := TenantFromContext(c.Request.Context())
+		c.String(http.StatusOK, tenant)
+	})
+	group.Global().GET("/books", bookResourceType, func(c *gin.Context) {
+		tenant, _ := TenantFrom(c)
+		c.String(http.StatusOK, tenant)
+	})
+
+	do := func(path string, tenant string, p *Principal) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if tenant != "" {
+			req.Header.Set(HeaderTenantID, tenant)
+		}
+		if p != nil {
+			req = req.WithContext(WithPrincipal(req.Context(), p))
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/api/v1/users", "acme", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "acme", w.Body.String())
+
+	w = do("/api/v1/users", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "TENANT_REQUIRED", decodeResponse(t, w).Error.Code)
+
+	w = do("/api/v1/users", "acme", &Principal{Subject: "1", Tenant: "globex"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "TENANT_MISMATCH", decodeResponse(t, w).Error.Code)
+
+	w = do("/api/v1/books", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Body.String())
+
+	w = do("/api/v1/books", "acme", &Principal{Subject: "1", Tenant: "acme"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "acme", w.Body.String())
+
+	// global routes don't require a tenant, but never take a foreign one
+	w = do("/api/v1/books", "acme", &Principal{Subject: "1", Tenant: "globex"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "TENANT_MISMATCH", decodeResponse(t, w).Error.Code)
+
+	// a principal without a tenant can't choose one
+	w = do("/api/v1/users", "acme", &Principal{Subject: "key-1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "TENANT_MISMATCH", decodeResponse(t, w).Error.Code)
+
+	assert.Equal(t, http.StatusNotFound, do("/api/v1/missing", "", nil).Code)
+}
+
+func TestTenantUnboundPrincipals(t *testing.T) {
+	e := New()
+	e.Use(injectPrincipal(), e.Tenant(TenantOptions{AllowUnboundPrincipals: true}))
+	e.Group("/api/v1").GET("/users", userResourceType, func(c *gin.Context) {
+		tenant, _ := TenantFrom(c)
+		c.String(http.StatusOK, tenant)
+	})
+
+	do := func(p *Principal) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+		req.Header.Set(HeaderTenantID, "acme")
+		e.ServeHTTP(w, req.WithContext(WithPrincipal(req.Context(), p)))
+		return w
+	}
+
+	w := do(&Principal{Subject: "key-1"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "acme", w.Body.String())
+
+	w = do(&Principal{Subject: "1", Tenant: "globex"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestTenantScope(t *testing.T) {
+	db, m, err := mock.GetNewMySqlMock()
+	assert.Nil(t, err)
+
+	type User struct {
+		ID       uint64
+		TenantID string
+		Name     string
+	}
+
+	m.ExpectQuery("SELECT \\* FROM `users` WHERE name = \\? AND `users`.`tenant_id` = \\?").
+		WithArgs("alex", "acme").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "name"}).AddRow(1, "acme", "alex"))
+
+	var users []User
+	ctx := WithTenant(context.Background(), "acme")
+	err = db.WithContext(ctx).Scopes(TenantScope).Where("name = ?", "alex").Find(&users).Error
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+	assert.Nil(t, m.ExpectationsWereMet())
+
+	err = db.WithContext(context.Background()).Scopes(TenantScope).Find(&users).Error
+	assert.ErrorIs(t, err, ErrTenantMissing)
+}
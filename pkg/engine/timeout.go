@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrHandlerTimeout is returned by the writes of a handler which
+	// keeps writing after its route timed out.
+	ErrHandlerTimeout = errors.New("handler timed out")
+)
+
+type timeoutWriterKey struct{}
+
+// timeoutWriter writes through to the underlying writer until a route
+// timeout applies, then it buffers the response so that either the whole
+// response of the handler or the timeout response is written, never both.
+type timeoutWriter struct {
+	w http.ResponseWriter
+
+	mutex     sync.Mutex
+	buffering bool
+	deadline  time.Time
+	header    http.Header
+	buf       bytes.Buffer
+	status    int
+	timedOut  bool
+	finished  bool
+
+	deadlineCh chan time.Time
+}
+
+func newTimeoutWriter(w http.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		w:          w,
+		deadlineCh: make(chan time.Time, 1),
+	}
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.buffering {
+		return tw.header
+	}
+	return tw.w.Header()
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.buffering && !time.Now().Before(tw.deadline) {
+		tw.expire()
+	}
+	if tw.timedOut {
+		return 0, ErrHandlerTimeout
+	}
+	if !tw.buffering {
+		return tw.w.Write(p)
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.buffering {
+		tw.w.WriteHeader(status)
+		return
+	}
+	if tw.status == 0 {
+		tw.status = status
+	}
+}
+
+// Flush only flushes the responses which are not buffered.
+func (tw *timeoutWriter) Flush() {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.buffering || tw.timedOut {
+		return
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	h, ok := tw.w.(http.Hijacker)
+	if tw.buffering || !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// setDeadline starts buffering the response, a later deadline than the
+// current one is ignored.
+func (tw *timeoutWriter) setDeadline(deadline time.Time) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if !tw.buffering {
+		tw.buffering = true
+		tw.header = tw.w.Header().Clone()
+	} else if !deadline.Before(tw.deadline) {
+		return
+	}
+	tw.deadline = deadline
+
+	select {
+	case <-tw.deadlineCh:
+	default:
+	}
+	tw.deadlineCh <- deadline
+}
+
+// finish writes the buffered response and writes through afterwards,
+// it's a no-op if the request already timed out. It reports whether the
+// request timed out.
+func (tw *timeoutWriter) finish() bool {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if !tw.buffering || tw.timedOut || tw.finished {
+		return tw.timedOut
+	}
+	if !time.Now().Before(tw.deadline) {
+		tw.expire()
+		return true
+	}
+	tw.finished = true
+
+	dst := tw.w.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	tw.w.WriteHeader(tw.status)
+	_, _ = tw.w.Write(tw.buf.Bytes())
+	tw.buffering = false
+	return false
+}
+
+// timeout writes the timeout response, it's a no-op if the handler
+// already finished. It reports whether the request timed out.
+func (tw *timeoutWriter) timeout() bool {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.finished {
+		return false
+	}
+	tw.expire()
+	return true
+}
+
+// expire writes the timeout response once, tw.mutex must be held.
+func (tw *timeoutWriter) expire() {
+	if tw.timedOut {
+		return
+	}
+	tw.timedOut = true
+
+	writeAPIError(tw.w, response.ErrGatewayTimeout)
+}
+
+// timedOutWriter reports the timeout response to the middlewares running
+// after a timed out handler, whatever the handler wrote.
+type timedOutWriter struct {
+	gin.ResponseWriter
+}
+
+func (w timedOutWriter) Status() int {
+	return http.StatusGatewayTimeout
+}
+
+func (w timedOutWriter) Written() bool {
+	return true
+}
+
+// hasTimeout reports whether the request can be routed to a route with a
+// timeout, which has to be served by serveWithTimeout.
+func (e *Engine) hasTimeout(req *http.Request) bool {
+	if e.timeouts.Load() {
+		return true
+	}
+
+	p := req.URL.Path
+	if e.UseRawPath && req.URL.RawPath != "" {
+		p = req.URL.RawPath
+	}
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	for _, reg := range e.timedRoutes {
+		if reg.method == req.Method && matchesRoute(reg.path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRoute reports whether p may be routed to route, the trailing
+// slashes are ignored so the paths redirected to the route match too.
+func matchesRoute(route string, p string) bool {
+	rs := strings.Split(strings.Trim(route, "/"), "/")
+	ps := strings.Split(strings.Trim(p, "/"), "/")
+	for i, r := range rs {
+		if strings.HasPrefix(r, "*") {
+			return true
+		}
+		if i >= len(ps) || (r != ps[i] && !strings.HasPrefix(r, ":")) {
+			return false
+		}
+	}
+	return len(rs) == len(ps)
+}
+
+// serveWithTimeout runs the routing in its own goroutine so that the
+// response can be given up when the deadline of a route is exceeded.
+func (e *Engine) serveWithTimeout(w http.ResponseWriter, req *http.Request) {
+	tw := newTimeoutWriter(w)
+	req = req.WithContext(context.WithValue(req.Context(), timeoutWriterKey{}, tw))
+
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		e.Engine.ServeHTTP(tw, req)
+	}()
+
+	var timer *time.Timer
+	var timerCh <-chan time.Time
+	for {
+		select {
+		case p := <-done:
+			if timer != nil {
+				timer.Stop()
+			}
+			if p != nil {
+				panic(p)
+			}
+			return
+		case deadline := <-tw.deadlineCh:
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(time.Until(deadline))
+			timerCh = timer.C
+		case <-timerCh:
+			if tw.timeout() {
+				go e.drainTimedOut(req, done)
+				return
+			}
+			timerCh = nil
+		}
+	}
+}
+
+// drainTimedOut waits for the handler of a timed out request and logs the
+// panic which can not be sent to the client anymore.
+func (e *Engine) drainTimedOut(req *http.Request, done <-chan interface{}) {
+	if p := <-done; p != nil {
+		e.logger.Errorw("panic after route timeout",
+			zap.String("method", req.Method),
+			zap.String("path", req.URL.Path),
+			zap.Any("panic", p),
+		)
+	}
+}
+
+// Timeout returns a middleware which sets a deadline of d on the request
+// context, the client gets ErrGatewayTimeout once it's exceeded and the
+// later writes of the handler are dropped. The response of the routes
+// using it is buffered, so it should not be used with streaming routes.
+// Since it can be installed anywhere, every request of the engine is
+// served in its own goroutine once it's used, WithTimeout only does so
+// for the routes of its group.
+func (e *Engine) Timeout(d time.Duration) gin.HandlerFunc {
+	e.timeouts.Store(true)
+	return e.timeout(d)
+}
+
+func (e *Engine) timeout(d time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := context.WithTimeout(ctx.Request.Context(), d)
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(c)
+
+		tw, ok := c.Value(timeoutWriterKey{}).(*timeoutWriter)
+		if !ok {
+			ctx.Next()
+			return
+		}
+
+		deadline, _ := c.Deadline()
+		tw.setDeadline(deadline)
+		ctx.Next()
+		// gin only writes a status without a body after the handlers return
+		ctx.Writer.WriteHeaderNow()
+		if tw.finish() {
+			ctx.Writer = timedOutWriter{ResponseWriter: ctx.Writer}
+		}
+	}
+}
+
+// WithTimeout returns a group sharing the path of rg whose routes time out
+// after d.
+func (rg RouterGroupWrapper) WithTimeout(d time.Duration) RouterGroupWrapper {
+	group := rg.Group("", rg.engine.timeout(d))
+	if group.meta.Timeout == 0 || d < group.meta.Timeout {
+		group.meta.Timeout = d
+	}
+	return group
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	e := New()
+	statuses := make(chan int, 1)
+	e.Use(func(c *gin.Context) {
+		c.Next()
+		statuses <- c.Writer.Status()
+	}, RequestID(&fakeIDGenerator{}))
+
+	lateWrite := make(chan error, 1)
+	group := e.Group("/api/v1").WithTimeout(50 * time.Millisecond)
+	group.GET("/fast", userResourceType, func(c *gin.Context) {
+		c.Header("X-Handler", "fast")
+		OK(c, "fast")
+	})
+	group.GET("/slow", userResourceType, func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		_, err := c.Writer.WriteString("late")
+		lateWrite <- err
+	})
+	group.WithTimeout(time.Hour).GET("/nested", userResourceType, func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(50*time.Millisecond), deadline, 50*time.Millisecond)
+		c.Status(http.StatusNoContent)
+	})
+	e.Group("/api/v1").GET("/untimed", userResourceType, func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		assert.False(t, ok)
+		assert.Nil(t, c.Request.Context().Value(timeoutWriterKey{}))
+		c.Status(http.StatusAccepted)
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/fast", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "fast", w.Header().Get("X-Handler"))
+	assert.Equal(t, "1", w.Header().Get(HeaderRequestID))
+	assert.Equal(t, "fast", decodeResponse(t, w).Data)
+	assert.Equal(t, http.StatusOK, <-statuses)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/slow", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	resp := decodeResponse(t, w)
+	assert.Equal(t, "GATEWAY_TIMEOUT", resp.Error.Code)
+	assert.Equal(t, "2", resp.Error.RequestID)
+	assert.Equal(t, ErrHandlerTimeout, <-lateWrite)
+	assert.NotContains(t, w.Body.String(), "late")
+	assert.Equal(t, http.StatusGatewayTimeout, <-statuses)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/nested", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusNoContent, <-statuses)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/untimed", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, http.StatusAccepted, <-statuses)
+}
+
+func TestTimeoutResponseController(t *testing.T) {
+	e := New()
+	e.Group("/api/v1").WithTimeout(time.Minute).GET("/users", userResourceType, func(c *gin.Context) {
+		err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(time.Minute))
+		assert.Nil(t, err)
+		c.Status(http.StatusNoContent)
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/users")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestMatchesRoute(t *testing.T) {
+	assert.True(t, matchesRoute("/api/v1/users", "/api/v1/users/"))
+	assert.True(t, matchesRoute("/api/v1/users/:user_id", "/api/v1/users/1"))
+	assert.True(t, matchesRoute("/static/*filepath", "/static/css/app.css"))
+	assert.True(t, matchesRoute("/", "/"))
+	assert.False(t, matchesRoute("/api/v1/users/:user_id", "/api/v1/users"))
+	assert.False(t, matchesRoute("/api/v1/users", "/api/v1/books"))
+	assert.False(t, matchesRoute("/api/v1/users", "/api/v1/users/1"))
+}
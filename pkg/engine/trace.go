@@ -0,0 +1,369 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/log"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+
+	spanContextKey = "engine/span"
+	loggerKey      = "engine/logger"
+)
+
+// ErrTraceparentInvalid is returned by ParseTraceparent.
+var ErrTraceparentInvalid = errors.New("engine: invalid traceparent")
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID identifies a span.
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is what is propagated of a span, as carried by the W3C
+// traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid reports whether neither of the IDs is all zeros.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats sc as a traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header value, the values of the
+// future versions are parsed by their version 00 prefix.
+func ParseTraceparent(v string) (SpanContext, error) {
+	var sc SpanContext
+	v = strings.TrimSpace(v)
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return sc, ErrTraceparentInvalid
+	}
+	version, err := hex.DecodeString(v[:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(v) != 55) || (len(v) > 55 && v[55] != '-') {
+		return sc, ErrTraceparentInvalid
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(v[3:35])); err != nil {
+		return sc, ErrTraceparentInvalid
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(v[36:52])); err != nil {
+		return sc, ErrTraceparentInvalid
+	}
+	flags, err := hex.DecodeString(v[53:55])
+	if err != nil || !sc.IsValid() || strings.ToLower(v[:55]) != v[:55] {
+		return SpanContext{}, ErrTraceparentInvalid
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+type spanContextCtxKey struct{}
+
+// WithSpanContext returns a copy of ctx carrying sc.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextCtxKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextCtxKey{}).(SpanContext)
+	return sc, ok
+}
+
+// SpanContextFrom returns the span context of the request.
+func SpanContextFrom(ctx *gin.Context) (SpanContext, bool) {
+	if v, ok := ctx.Get(spanContextKey); ok {
+		sc, ok := v.(SpanContext)
+		return sc, ok
+	}
+	if ctx.Request == nil {
+		return SpanContext{}, false
+	}
+	return SpanContextFromContext(ctx.Request.Context())
+}
+
+// InjectTrace sets the traceparent and tracestate headers of an outgoing
+// request from the span context carried by ctx.
+func InjectTrace(ctx context.Context, h http.Header) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return
+	}
+	h.Set(HeaderTraceparent, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(HeaderTracestate, sc.TraceState)
+	} else {
+		h.Del(HeaderTracestate)
+	}
+}
+
+// Span is a finished span.
+type Span struct {
+	Name         string                 `json:"name"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Error        bool                   `json:"error,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// SpanExporter exports the finished spans.
+type SpanExporter interface {
+	Export(ctx context.Context, span *Span) error
+}
+
+// JSONExporter writes the spans as JSON lines.
+type JSONExporter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// NewJSONExporter creates a JSONExporter writing to w, os.Stdout if nil.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &JSONExporter{w: w}
+}
+
+// Export implements SpanExporter.
+func (x *JSONExporter) Export(_ context.Context, span *Span) error {
+	p, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	_, err = x.w.Write(append(p, '\n'))
+	return err
+}
+
+// MemoryExporter keeps the spans in memory, it's meant for the tests.
+type MemoryExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+// NewMemoryExporter creates a MemoryExporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+// Export implements SpanExporter.
+func (x *MemoryExporter) Export(_ context.Context, span *Span) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.spans = append(x.spans, span)
+	return nil
+}
+
+// Spans returns the exported spans.
+func (x *MemoryExporter) Spans() []*Span {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return append([]*Span{}, x.spans...)
+}
+
+// Reset drops the exported spans.
+func (x *MemoryExporter) Reset() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.spans = nil
+}
+
+// Sampler decides whether a new trace is sampled.
+type Sampler func(TraceID) bool
+
+// RatioSampler samples ratio of the traces, the decision only depends on
+// the trace ID.
+func RatioSampler(ratio float64) Sampler {
+	bound := uint64(ratio * (1 << 63))
+	return func(id TraceID) bool {
+		if ratio >= 1 {
+			return true
+		}
+		return binary.BigEndian.Uint64(id[8:])>>1 < bound
+	}
+}
+
+// TracingOptions configures the Tracing middleware.
+type TracingOptions struct {
+	// Exporter exports the sampled spans, a JSONExporter writing to
+	// os.Stdout by default.
+	Exporter SpanExporter
+	// Sampler decides whether the traces started by the engine are
+	// sampled, all of them by default. The traces propagated by the
+	// clients keep their decision.
+	Sampler Sampler
+}
+
+// Tracing returns a middleware which continues the trace propagated by
+// the traceparent header, or starts a new one, with a span named by the
+// route template and tagged with its ResourceType. The span context is
+// stored in the request context for InjectTrace, and LoggerFrom returns a
+// logger with the trace_id and span_id fields.
+func (e *Engine) Tracing(opts TracingOptions) gin.HandlerFunc {
+	if opts.Exporter == nil {
+		opts.Exporter = NewJSONExporter(nil)
+	}
+	if opts.Sampler == nil {
+		opts.Sampler = RatioSampler(1)
+	}
+
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		parent, err := ParseTraceparent(ctx.GetHeader(HeaderTraceparent))
+		hasParent := err == nil
+
+		sc := SpanContext{SpanID: newSpanID()}
+		if hasParent {
+			sc.TraceID = parent.TraceID
+			sc.Sampled = parent.Sampled
+			sc.TraceState = ctx.GetHeader(HeaderTracestate)
+		} else {
+			sc.TraceID = newTraceID()
+			sc.Sampled = opts.Sampler(sc.TraceID)
+		}
+
+		ctx.Set(spanContextKey, sc)
+		ctx.Set(loggerKey, e.logger.With(traceFields(sc)...))
+		ctx.Request = ctx.Request.WithContext(WithSpanContext(ctx.Request.Context(), sc))
+
+		// the span is exported even if a handler panics, then the panic
+		// goes on to the recovery middleware
+		defer func() {
+			r := recover()
+			if sc.Sampled {
+				span := e.newSpan(ctx, sc, start, r)
+				if hasParent {
+					span.ParentSpanID = parent.SpanID.String()
+				}
+				if err := opts.Exporter.Export(ctx.Request.Context(), span); err != nil {
+					e.logger.Warnw("export span failed", zap.String("span", span.Name), zap.Error(err))
+				}
+			}
+			if r != nil {
+				panic(r)
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+// newSpan builds the span of a request which is done, recovered is the
+// value of the panic which ended it, if any.
+func (e *Engine) newSpan(ctx *gin.Context, sc SpanContext, start time.Time, recovered interface{}) *Span {
+	route := ctx.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+	typ, _ := e.ResourceTypeOf(ctx)
+	status := ctx.Writer.Status()
+	if recovered != nil && !ctx.Writer.Written() {
+		status = http.StatusInternalServerError
+	}
+	span := &Span{
+		Name:    FormatRoute(ctx.Request.Method, route),
+		TraceID: sc.TraceID.String(),
+		SpanID:  sc.SpanID.String(),
+		Start:   start,
+		End:     time.Now(),
+		Error:   recovered != nil || status >= http.StatusInternalServerError,
+		Attributes: map[string]interface{}{
+			"http.method":      ctx.Request.Method,
+			"http.route":       route,
+			"http.target":      ctx.Request.URL.Path,
+			"http.status_code": status,
+			"request_id":       RequestIDFrom(ctx),
+			"resource.scope":   string(typ.Scope),
+			"resource.name":    typ.Resource,
+		},
+	}
+	if recovered != nil {
+		span.Attributes["panic"] = fmt.Sprint(recovered)
+	}
+	if len(ctx.Errors) > 0 {
+		span.Attributes["errors"] = ctx.Errors.String()
+	}
+	return span
+}
+
+// LoggerFrom returns the logger of the request, which adds the trace_id
+// and span_id fields if the request is traced.
+func (e *Engine) LoggerFrom(ctx *gin.Context) *log.Logger {
+	if v, ok := ctx.Get(loggerKey); ok {
+		if logger, ok := v.(*log.Logger); ok {
+			return logger
+		}
+	}
+	return e.logger
+}
+
+func traceFields(sc SpanContext) []zap.Field {
+	return []zap.Field{
+		zap.String("trace_id", sc.TraceID.String()),
+		zap.String("span_id", sc.SpanID.String()),
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		mustRandom(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		mustRandom(id[:])
+	}
+	return id
+}
+
+func mustRandom(p []byte) {
+	if _, err := rand.Read(p); err != nil {
+		panic(fmt.Sprintf("engine: read random: %v", err))
+	}
+}
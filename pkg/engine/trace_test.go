@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent(testTraceparent)
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, testTraceparent, sc.Traceparent())
+
+	sc, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	assert.Nil(t, err)
+	assert.False(t, sc.Sampled)
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(v)
+		assert.ErrorIs(t, err, ErrTraceparentInvalid, v)
+	}
+}
+
+func TestRatioSampler(t *testing.T) {
+	assert.True(t, RatioSampler(1)(newTraceID()))
+	assert.False(t, RatioSampler(0)(newTraceID()))
+
+	sampled := 0
+	half := RatioSampler(0.5)
+	for i := 0; i < 1000; i++ {
+		if half(newTraceID()) {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 500, sampled, 100)
+}
+
+func TestTracing(t *testing.T) {
+	logger, fws := newTestLogger(t)
+	exporter := NewMemoryExporter()
+	e := New(WithLogger(logger))
+	e.Use(e.AccessLog(), e.Tracing(TracingOptions{Exporter: exporter}), ErrorHandler())
+
+	var propagated http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		propagated = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	group := e.Group("/api/v1")
+	group.GET("/users/:user_id", userResourceType, func(c *gin.Context) {
+		e.LoggerFrom(c).Infow("loading user")
+		c.Status(http.StatusOK)
+	})
+	group.POST("/books", bookResourceType, func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+	group.Proxy("/legacy", backend.URL, bookResourceType)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil)
+	req.Header.Set(HeaderTraceparent, testTraceparent)
+	req.Header.Set(HeaderTracestate, "vendor=1")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	spans := exporter.Spans()
+	assert.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /api/v1/users/:user_id", span.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+	assert.NotEqual(t, span.ParentSpanID, span.SpanID)
+	assert.False(t, span.Error)
+	assert.Equal(t, "management", span.Attributes["resource.scope"])
+	assert.Equal(t, "user", span.Attributes["resource.name"])
+	assert.Equal(t, http.StatusOK, span.Attributes["http.status_code"])
+
+	lines := strings.Split(strings.TrimSpace(fws.buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		var fields map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &fields))
+		assert.Equal(t, span.TraceID, fields["trace_id"])
+		assert.Equal(t, span.SpanID, fields["span_id"])
+	}
+
+	exporter.Reset()
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/books", nil))
+	spans = exporter.Spans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "POST /api/v1/books", spans[0].Name)
+	assert.Empty(t, spans[0].ParentSpanID)
+	assert.True(t, spans[0].Error)
+
+	exporter.Reset()
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown/1", nil))
+	assert.Equal(t, "GET <unmatched>", exporter.Spans()[0].Name)
+
+	// the sampling decision of the client is kept
+	exporter.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/legacy/1", nil)
+	req.Header.Set(HeaderTraceparent, strings.TrimSuffix(testTraceparent, "01")+"00")
+	req.Header.Set(HeaderTracestate, "vendor=1")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, exporter.Spans())
+	sc, err := ParseTraceparent(propagated.Get(HeaderTraceparent))
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.NotEqual(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.False(t, sc.Sampled)
+	assert.Equal(t, "vendor=1", propagated.Get(HeaderTracestate))
+}
+
+func TestTracingPanic(t *testing.T) {
+	logger, _ := newTestLogger(t)
+	exporter := NewMemoryExporter()
+	e := New(WithLogger(logger))
+	e.Use(Recovery(logger), e.Tracing(TracingOptions{Exporter: exporter}))
+	e.Group("/api/v1").GET("/users/:user_id", userResourceType, func(c *gin.Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	spans := exporter.Spans()
+	assert.Len(t, spans, 1)
+	assert.True(t, spans[0].Error)
+	assert.Equal(t, "boom", spans[0].Attributes["panic"])
+	assert.Equal(t, http.StatusInternalServerError, spans[0].Attributes["http.status_code"])
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	x := NewJSONExporter(&buf)
+	assert.Nil(t, x.Export(context.Background(), &Span{Name: "GET /", TraceID: "t", SpanID: "s"}))
+	assert.Nil(t, x.Export(context.Background(), &Span{Name: "POST /", TraceID: "t", SpanID: "s2"}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	var span Span
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &span))
+	assert.Equal(t, "POST /", span.Name)
+
+	h := http.Header{}
+	InjectTrace(context.Background(), h)
+	assert.Empty(t, h)
+}
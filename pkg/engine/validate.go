@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrRouteShadowed is reported for a parameter or wildcard route
+	// matching the paths of a static route of the same method.
+	ErrRouteShadowed = errors.New("engine: shadowed route")
+	// ErrRouteTrailingSlash is reported for two routes of the same method
+	// whose paths differ only by a trailing slash.
+	ErrRouteTrailingSlash = errors.New("engine: routes differ only by trailing slash")
+)
+
+// routeRegistration is a route as it was registered, unlike the keys of
+// Routers its path keeps the trailing slash.
+type routeRegistration struct {
+	method string
+	path   string
+	typ    ResourceType
+}
+
+func (r routeRegistration) String() string {
+	return FormatRoute(r.method, r.path)
+}
+
+// Validate reports the routes which override or hide each other: routes
+// whose paths differ only by a trailing slash, which share a key of
+// Routers and are reported as duplicates if their ResourceTypes differ,
+// and parameter or wildcard routes shadowing static ones.
+func (e *Engine) Validate() error {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	var errs []error
+	for i, reg := range e.registrations {
+		if err := conflictsWith(reg, e.registrations[:i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// conflictsWith returns the conflicts between reg and the routes
+// registered before it.
+func conflictsWith(reg routeRegistration, registered []routeRegistration) error {
+	var errs []error
+	for _, other := range registered {
+		if other.method != reg.method || other.path == reg.path {
+			continue
+		}
+
+		if strings.TrimSuffix(other.path, "/") == strings.TrimSuffix(reg.path, "/") {
+			errs = append(errs, fmt.Errorf("%w: %s and %s", ErrRouteTrailingSlash, other, reg))
+			if other.typ != reg.typ {
+				errs = append(errs, fmt.Errorf("%w: %s is bound to %s/%s and %s/%s", ErrRouteDuplicate,
+					FormatRoute(reg.method, strings.TrimSuffix(reg.path, "/")),
+					other.typ.Scope, other.typ.Resource, reg.typ.Scope, reg.typ.Resource))
+			}
+			continue
+		}
+
+		if shadows(other.path, reg.path) {
+			errs = append(errs, fmt.Errorf("%w: %s shadows %s", ErrRouteShadowed, other, reg))
+		} else if shadows(reg.path, other.path) {
+			errs = append(errs, fmt.Errorf("%w: %s shadows %s", ErrRouteShadowed, reg, other))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shadows reports whether the pattern matches every path of the static
+// route, having a parameter or a wildcard where the route has a static
+// segment.
+func shadows(pattern string, route string) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	rs := strings.Split(strings.Trim(route, "/"), "/")
+
+	dynamic := false
+	for i, p := range ps {
+		if strings.HasPrefix(p, "*") {
+			for _, r := range rs[min(i, len(rs)):] {
+				dynamic = dynamic || !isDynamicSegment(r)
+			}
+			return dynamic
+		}
+		if i >= len(rs) {
+			return false
+		}
+		switch {
+		case p == rs[i]:
+		case strings.HasPrefix(p, ":") && !isDynamicSegment(rs[i]):
+			dynamic = true
+		case strings.HasPrefix(p, ":") && strings.HasPrefix(rs[i], ":"):
+		default:
+			return false
+		}
+	}
+	return dynamic && len(ps) == len(rs)
+}
+
+func isDynamicSegment(s string) bool {
+	return strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*")
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadows(t *testing.T) {
+	assert.True(t, shadows("/users/:id", "/users/me"))
+	assert.True(t, shadows("/files/*path", "/files/readme"))
+	assert.True(t, shadows("/:scope/books/:id", "/store/books/:book_id"))
+	assert.False(t, shadows("/users/:id", "/users/:user_id"))
+	assert.False(t, shadows("/users/:id", "/users/me/books"))
+	assert.False(t, shadows("/users/me", "/users/:id"))
+	assert.False(t, shadows("/users/:id", "/books/1"))
+	assert.False(t, shadows("/files/*path", "/files"))
+}
+
+func TestValidate(t *testing.T) {
+	e := New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	group := e.Group("/api/v1")
+	group.GET("/users/:user_id", userResourceType, ok)
+	group.GET("/books/:book_id", bookResourceType, ok)
+	assert.Nil(t, e.Validate())
+
+	group.GET("/users/me", userResourceType, ok)
+	group.GET("/books/", bookResourceType, ok)
+	group.GET("/books", reviewResourceType, ok)
+	group.POST("/users/me", userResourceType, ok)
+
+	err := e.Validate()
+	assert.ErrorIs(t, err, ErrRouteShadowed)
+	assert.ErrorIs(t, err, ErrRouteTrailingSlash)
+	assert.ErrorIs(t, err, ErrRouteDuplicate)
+	assert.Contains(t, err.Error(), "GET /api/v1/users/:user_id shadows GET /api/v1/users/me")
+	assert.Contains(t, err.Error(), "GET /api/v1/books/ and GET /api/v1/books")
+	assert.Contains(t, err.Error(), "GET /api/v1/books is bound to store/book and store/review")
+	assert.NotContains(t, err.Error(), "POST")
+}
+
+func TestStrictRoutes(t *testing.T) {
+	e := New(WithStrictRoutes())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	group := e.Group("/api/v1")
+	group.GET("/users/:user_id", userResourceType, ok)
+	assert.PanicsWithError(t, "engine: shadowed route: GET /api/v1/users/:user_id shadows GET /api/v1/users/me", func() {
+		group.GET("/users/me", userResourceType, ok)
+	})
+	_, found := e.Routers["GET /api/v1/users/me"]
+	assert.False(t, found)
+
+	err := group.Register([]RouteSpec{
+		{Method: http.MethodGet, Path: "/books", ResourceType: bookResourceType, Handler: ok},
+		{Method: http.MethodGet, Path: "/books/", ResourceType: bookResourceType, Handler: ok},
+	})
+	assert.ErrorIs(t, err, ErrRouteTrailingSlash)
+	_, found = e.Routers["GET /api/v1/books"]
+	assert.False(t, found)
+	assert.Nil(t, e.Validate())
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daemgo/gopkg/pkg/engine/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderAPIVersion carries the API version of the request and the response.
+	HeaderAPIVersion  = "API-Version"
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+)
+
+// RouteMeta is what is known about a route besides its ResourceType.
+type RouteMeta struct {
+	// Version is the API version the route belongs to.
+	Version string
+	// Deprecation is set if the route is deprecated.
+	Deprecation *Deprecation
+	// Global is set if the route is not scoped to a tenant.
+	Global bool
+	// Feature is the feature flag gating the route, if any.
+	Feature string
+	// Timeout is the timeout of the route, if any.
+	Timeout time.Duration
+}
+
+// Deprecation describes a deprecated route.
+type Deprecation struct {
+	// Since is when the route was deprecated, optional.
+	Since time.Time
+	// Sunset is when the route will be removed, optional.
+	Sunset time.Time
+	// Link points to the migration guide, optional.
+	Link string
+}
+
+// Version returns a group at rg's path joined with version, e.g. "v2",
+// whose routes are recorded with the version and respond with it in the
+// API-Version header.
+func (rg RouterGroupWrapper) Version(version string) RouterGroupWrapper {
+	group := rg.Group(version, func(ctx *gin.Context) {
+		ctx.Header(HeaderAPIVersion, version)
+		ctx.Next()
+	})
+	group.meta.Version = version
+	return group
+}
+
+// Deprecated returns a group sharing the path of rg whose routes are
+// deprecated, they respond with the Deprecation and Sunset headers and
+// every call to them is logged as a warning.
+func (rg RouterGroupWrapper) Deprecated(d Deprecation) RouterGroupWrapper {
+	deprecation := "true"
+	if !d.Since.IsZero() {
+		deprecation = "@" + strconv.FormatInt(d.Since.Unix(), 10)
+	}
+	var sunset string
+	if !d.Sunset.IsZero() {
+		sunset = d.Sunset.UTC().Format(http.TimeFormat)
+	}
+
+	e := rg.engine
+	group := rg.Group("", func(ctx *gin.Context) {
+		ctx.Header(HeaderDeprecation, deprecation)
+		if sunset != "" {
+			ctx.Header(HeaderSunset, sunset)
+		}
+		if d.Link != "" {
+			ctx.Header("Link", "<"+d.Link+`>; rel="deprecation"`)
+		}
+
+		meta, _ := e.RouteMetaOf(ctx)
+		e.logger.Warnw("deprecated route called",
+			zap.String("request_id", RequestIDFrom(ctx)),
+			zap.String("method", ctx.Request.Method),
+			zap.String("route", ctx.FullPath()),
+			zap.String("version", meta.Version),
+			zap.String("sunset", sunset),
+			zap.String("client_ip", ctx.ClientIP()),
+			zap.String("actor", ActorFromPrincipal(ctx)),
+		)
+		ctx.Next()
+	})
+	group.meta.Deprecation = &d
+	return group
+}
+
+// VersionOptions configures the header based version negotiation.
+type VersionOptions struct {
+	// Prefix is the path the versions are mounted under, e.g. "/api".
+	Prefix string
+	// Header carries the requested version, "API-Version" by default.
+	Header string
+	// Default is the version used if the header is missing, the request
+	// is left as it is if it's empty.
+	Default string
+	// Versions are the supported versions.
+	Versions []string
+}
+
+// NegotiateVersion lets the clients request "/api/users" with a version
+// header instead of "/api/v2/users", the path is rewritten before routing.
+// Paths already containing a version are left as they are. It must be
+// called before the engine starts serving.
+func (e *Engine) NegotiateVersion(opts VersionOptions) {
+	if opts.Header == "" {
+		opts.Header = HeaderAPIVersion
+	}
+	opts.Prefix = path.Join("/", opts.Prefix)
+	e.versioning = &opts
+}
+
+// rewriteVersion rewrites the path of req with the negotiated version,
+// it returns an error for unsupported versions.
+func (o *VersionOptions) rewriteVersion(req *http.Request) *response.APIError {
+	p := req.URL.Path
+	prefix := strings.TrimSuffix(o.Prefix, "/")
+	if !strings.HasPrefix(p, prefix+"/") {
+		return nil
+	}
+	rest := p[len(prefix):]
+	first, _, _ := strings.Cut(rest[1:], "/")
+	if containsFold(o.Versions, first) {
+		return nil
+	}
+
+	version := req.Header.Get(o.Header)
+	if version == "" {
+		version = o.Default
+	}
+	if version == "" {
+		return nil
+	}
+	supported, ok := o.supported(version)
+	if !ok {
+		return response.ErrBadRequest.WithMessage("unsupported API version " + version)
+	}
+
+	req.URL.Path = prefix + "/" + supported + rest
+	req.URL.RawPath = ""
+	return nil
+}
+
+// supported returns the entry of Versions matching version case
+// insensitively, it's the one the routes are mounted with.
+func (o *VersionOptions) supported(version string) (string, bool) {
+	for _, v := range o.Versions {
+		if strings.EqualFold(v, version) {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionAndDeprecation(t *testing.T) {
+	logger, fws := newTestLogger(t)
+	e := New(WithLogger(logger), WithIDGenerator(&fakeIDGenerator{}))
+	e.NegotiateVersion(VersionOptions{
+		Prefix:   "/api",
+		Default:  "v1",
+		Versions: []string{"v1", "v2"},
+	})
+
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := e.Group("/api")
+	v1 := api.Version("v1").Deprecated(Deprecation{
+		Since:  time.Unix(1700000000, 0),
+		Sunset: sunset,
+		Link:   "https://example.com/migrate",
+	})
+	v1.GET("/users", userResourceType, func(c *gin.Context) {
+		c.String(http.StatusOK, "v1")
+	})
+	api.Version("v2").GET("/users", userResourceType, func(c *gin.Context) {
+		c.String(http.StatusOK, "v2")
+	})
+
+	assert.Equal(t, RouteMeta{Version: "v2"}, e.routeMeta["GET /api/v2/users"])
+	assert.Equal(t, "v1", e.routeMeta["GET /api/v1/users"].Version)
+	assert.Equal(t, sunset, e.routeMeta["GET /api/v1/users"].Deprecation.Sunset)
+
+	do := func(path, version string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if version != "" {
+			req.Header.Set(HeaderAPIVersion, version)
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/api/v2/users", "")
+	assert.Equal(t, "v2", w.Body.String())
+	assert.Equal(t, "v2", w.Header().Get(HeaderAPIVersion))
+	assert.Empty(t, w.Header().Get(HeaderDeprecation))
+
+	w = do("/api/users", "v2")
+	assert.Equal(t, "v2", w.Body.String())
+
+	w = do("/api/users", "V2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v2", w.Body.String())
+
+	w = do("/api/users", "")
+	assert.Equal(t, "v1", w.Body.String())
+	assert.Equal(t, "@1700000000", w.Header().Get(HeaderDeprecation))
+	assert.Equal(t, "Fri, 01 Jan 2027 00:00:00 GMT", w.Header().Get(HeaderSunset))
+	assert.Equal(t, `<https://example.com/migrate>; rel="deprecation"`, w.Header().Get("Link"))
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(fws.buf.Bytes(), &entry))
+	assert.Equal(t, "deprecated route called", entry["message"])
+	assert.Equal(t, "/api/v1/users", entry["route"])
+	assert.Equal(t, "v1", entry["version"])
+
+	w = do("/api/users", "v3")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeResponse(t, w)
+	assert.Equal(t, "unsupported API version v3", resp.Error.Message)
+	assert.Equal(t, "1", resp.Error.RequestID)
+	assert.Equal(t, "1", w.Header().Get(HeaderRequestID))
+}
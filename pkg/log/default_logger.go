@@ -116,3 +116,8 @@ func Fatalf(template string, args ...interface{}) {
 func Fatalw(message string, fields ...zapcore.Field) {
 	DefaultLogger.Fatalw(message, fields...)
 }
+
+// Sync flushes all buffered logs of the DefaultLogger.
+func Sync() error {
+	return DefaultLogger.Sync()
+}
@@ -65,6 +65,15 @@ func (logger *Logger) Close() (err error) {
 	return nil
 }
 
+// With returns a child logger which adds fields to every message, the
+// logger itself is left unchanged.
+func (logger *Logger) With(fields ...zapcore.Field) *Logger {
+	child := *logger
+	child.core = logger.core.With(fields)
+	child.skipFramesOnce = 0
+	return &child
+}
+
 func (logger *Logger) SkipFramesOnce(frames int) *Logger {
 	logger.skipFramesOnce += frames
 	return logger
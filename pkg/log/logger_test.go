@@ -166,3 +166,19 @@ func TestZapLogger(t *testing.T) {
 	p = fws.bytes()
 	assert.Contains(t, string(p), "this message should be seen")
 }
+
+func TestLoggerWith(t *testing.T) {
+	fws := &fakeWriteSyncer{}
+	logger, err := NewLogger(WithLogLevel("info"), WithWriteSyncer(fws))
+	assert.Nil(t, err, "failed to new logger: ", err)
+	defer logger.Close()
+
+	child := logger.With(zap.String("name", "child"))
+	child.Info("from child")
+	fields := unmarshalLogMessage(t, fws.bytes())
+	assert.Equal(t, "child", fields.Name)
+
+	logger.Info("from parent")
+	fields = unmarshalLogMessage(t, fws.bytes())
+	assert.Equal(t, "", fields.Name)
+}